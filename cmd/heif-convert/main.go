@@ -0,0 +1,241 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strukturag/libheif-go"
+)
+
+var (
+	imageID         = flag.Int("id", 0, "id of the image to convert (default: primary image)")
+	quality         = flag.Int("quality", 90, "quality of JPEG output (1-100)")
+	withThumbnails  = flag.Bool("thumbnails", false, "write thumbnails as separate files")
+	withDepth       = flag.Bool("depth", false, "write depth images as separate files")
+	withAuxiliary   = flag.Bool("aux", false, "write auxiliary images as separate files")
+	withExif        = flag.Bool("exif", false, "write EXIF metadata to a sidecar file")
+	ignoreTransform = flag.Bool("ignore-transformations", false, "do not apply rotation, mirroring and cropping")
+)
+
+type imageWriter func(filename string, img image.Image) error
+
+func writeFile(filename string, write func(f *os.File) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close() // nolint
+		return err
+	}
+
+	return f.Close()
+}
+
+func writePNG(filename string, img image.Image) error {
+	return writeFile(filename, func(f *os.File) error {
+		return png.Encode(f, img)
+	})
+}
+
+func writeJPEG(filename string, img image.Image) error {
+	return writeFile(filename, func(f *os.File) error {
+		return jpeg.Encode(f, img, &jpeg.Options{
+			Quality: *quality,
+		})
+	})
+}
+
+func writeGIF(filename string, img image.Image) error {
+	return writeFile(filename, func(f *os.File) error {
+		return gif.Encode(f, img, nil)
+	})
+}
+
+func getImageWriter(filename string) (imageWriter, error) {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".png":
+		return writePNG, nil
+	case ".jpg", ".jpeg":
+		return writeJPEG, nil
+	case ".gif":
+		return writeGIF, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q, use .png, .jpg, .jpeg or .gif", ext)
+	}
+}
+
+// sidecarName returns the filename of an additional output file, e.g.
+// "out-thumb-2.png" for "out.png".
+func sidecarName(output string, suffix string, ext string) string {
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	return base + suffix + ext
+}
+
+func convert(handle *libheif.ImageHandle, options *libheif.DecodeOptions, filename string, write imageWriter) error {
+	img, err := handle.Decode(options)
+	if err != nil {
+		return fmt.Errorf("could not decode image %d: %w", handle.GetItemID(), err)
+	}
+
+	if err := write(filename, img); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+
+	fmt.Printf("Written to %s\n", filename)
+	return nil
+}
+
+func writeExif(handle *libheif.ImageHandle, filename string) error {
+	exif, err := handle.GetExif()
+	if err != nil {
+		return fmt.Errorf("could not read EXIF metadata: %w", err)
+	}
+	if exif == nil {
+		fmt.Println("Image has no EXIF metadata")
+		return nil
+	}
+
+	if err := os.WriteFile(filename, exif.Bytes(), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+
+	fmt.Printf("EXIF metadata written to %s\n", filename)
+	return nil
+}
+
+func run(input string, output string) error {
+	write, err := getImageWriter(output)
+	if err != nil {
+		return err
+	}
+
+	if *quality < 1 || *quality > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+
+	ctx, err := libheif.NewContext()
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.ReadFromFile(input); err != nil {
+		return fmt.Errorf("could not read %s: %w", input, err)
+	}
+
+	var handle *libheif.ImageHandle
+	if *imageID != 0 {
+		handle, err = ctx.GetImageHandle(*imageID)
+	} else {
+		handle, err = ctx.GetPrimaryImageHandle()
+	}
+	if err != nil {
+		return fmt.Errorf("could not get image: %w", err)
+	}
+
+	decodingOptions, err := libheif.NewDecodingOptions()
+	if err != nil {
+		return err
+	}
+	decodingOptions.SetIgnoreTransformations(*ignoreTransform)
+	options := &libheif.DecodeOptions{
+		Options: decodingOptions,
+	}
+
+	if err := convert(handle, options, output, write); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(output)
+	if *withThumbnails {
+		for _, id := range handle.GetListOfThumbnailIDs() {
+			thumbnail, err := handle.GetThumbnail(id)
+			if err != nil {
+				return fmt.Errorf("could not get thumbnail %d: %w", id, err)
+			}
+
+			if err := convert(thumbnail, options, sidecarName(output, fmt.Sprintf("-thumb-%d", id), ext), write); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *withDepth {
+		for _, id := range handle.GetListOfDepthImageIDs() {
+			depth, err := handle.GetDepthImageHandle(id)
+			if err != nil {
+				return fmt.Errorf("could not get depth image %d: %w", id, err)
+			}
+
+			if err := convert(depth, options, sidecarName(output, fmt.Sprintf("-depth-%d", id), ext), write); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *withAuxiliary {
+		for _, id := range handle.GetListOfAuxiliaryImageIDs() {
+			aux, err := handle.GetAuxiliaryImageHandle(id)
+			if err != nil {
+				return fmt.Errorf("could not get auxiliary image %d: %w", id, err)
+			}
+
+			if err := convert(aux, options, sidecarName(output, fmt.Sprintf("-aux-%d", id), ext), write); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *withExif {
+		if err := writeExif(handle, sidecarName(output, "", ".exif")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <input> <output.png|output.jpg|output.gif>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,283 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strukturag/libheif-go"
+)
+
+type parameterList []string
+
+func (l *parameterList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *parameterList) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("parameter %q must be in the form name=value", value)
+	}
+
+	*l = append(*l, value)
+	return nil
+}
+
+var (
+	output        = flag.String("o", "", "output filename (default: input with .heic / .avif extension)")
+	quality       = flag.Int("q", 50, "quality (0-100)")
+	lossless      = flag.Bool("L", false, "enable lossless encoding")
+	avif          = flag.Bool("avif", false, "encode as AVIF instead of HEIC")
+	encoderID     = flag.String("e", "", "id of the encoder to use (default: encoder with highest priority)")
+	thumbnailSize = flag.Int("t", 0, "add a thumbnail that fits into a square of the given size (0: no thumbnail)")
+	copyExif      = flag.Bool("exif", true, "copy EXIF metadata from JPEG input")
+	listParams    = flag.Bool("list-params", false, "print the parameters of the encoder and exit")
+	parameters    parameterList
+)
+
+func init() {
+	flag.Var(&parameters, "p", "set encoder parameter in the form name=value (can be repeated)")
+}
+
+// compressionFormat returns the compression format of the encoder selected
+// with -e, or of the format selected with -avif.
+func compressionFormat() (libheif.CompressionFormat, error) {
+	if *encoderID == "" {
+		if *avif {
+			return libheif.CompressionAV1, nil
+		}
+
+		return libheif.CompressionHEVC, nil
+	}
+
+	for _, d := range libheif.ListEncoders(libheif.CompressionUndefined, false) {
+		if d.ID != *encoderID {
+			continue
+		}
+
+		if *avif && d.CompressionFormat != libheif.CompressionAV1 {
+			return libheif.CompressionUndefined, fmt.Errorf("encoder %s does not support AVIF", d.ID)
+		}
+
+		return d.CompressionFormat, nil
+	}
+
+	return libheif.CompressionUndefined, fmt.Errorf("no encoder with id %q", *encoderID)
+}
+
+func newEncoder() (*libheif.Encoder, error) {
+	ctx, err := libheif.NewContext()
+	if err != nil {
+		return nil, err
+	}
+
+	if *encoderID != "" {
+		return ctx.NewEncoderByID(*encoderID)
+	}
+
+	format, err := compressionFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx.NewEncoder(format)
+}
+
+func printParameters() error {
+	enc, err := newEncoder()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Parameters for encoder %s (%s):\n", enc.ID(), enc.Name())
+	for _, p := range enc.ListParameters() {
+		value, err := enc.GetParameter(p.Name())
+		if err != nil {
+			value = "n/a"
+		}
+		fmt.Printf("  %s, current=%s\n", p, value)
+	}
+	return nil
+}
+
+// readJPEGExif returns the EXIF data of a JPEG file or nil if it has none.
+func readJPEGExif(data []byte) []byte {
+	exifHeader := []byte("Exif\x00\x00")
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+
+	data = data[2:]
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		if marker == 0xda || marker == 0xd9 {
+			// Start of scan / end of image, no more metadata segments.
+			break
+		}
+
+		size := int(binary.BigEndian.Uint16(data[2:]))
+		if size < 2 || size+2 > len(data) {
+			break
+		}
+
+		segment := data[4 : size+2]
+		if marker == 0xe1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+		data = data[size+2:]
+	}
+	return nil
+}
+
+// convertImage converts images to a type supported by EncodeFromImage.
+func convertImage(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.RGBA64, *image.NRGBA64, *image.Gray, *image.YCbCr:
+		return img
+	default:
+		b := img.Bounds()
+		out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+		return out
+	}
+}
+
+func outputFilename(input string, format libheif.CompressionFormat) string {
+	if *output != "" {
+		return *output
+	}
+
+	ext := ".heic"
+	if format == libheif.CompressionAV1 {
+		ext = ".avif"
+	}
+	return strings.TrimSuffix(input, filepath.Ext(input)) + ext
+}
+
+func run(input string, compression libheif.CompressionFormat) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not decode %s: %w", input, err)
+	}
+
+	options := []libheif.EncodeOption{
+		libheif.SetEncoderQuality(*quality),
+	}
+	if *lossless {
+		options = append(options, libheif.SetEncoderLossless(libheif.LosslessModeEnabled))
+	}
+	if *encoderID != "" {
+		options = append(options, libheif.UseEncoder(*encoderID))
+	}
+	for _, p := range parameters {
+		name, value, _ := strings.Cut(p, "=")
+		options = append(options, libheif.SetEncoderParameter(name, value))
+	}
+	if *thumbnailSize > 0 {
+		options = append(options, libheif.WithThumbnail(*thumbnailSize))
+	}
+
+	if exifData := readJPEGExif(data); *copyExif && format == "jpeg" && exifData != nil {
+		exif, err := libheif.ParseExif(exifData)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring invalid EXIF metadata: %s\n", err)
+		} else {
+			// The pixel data is not rotated, store the orientation as
+			// transformations and reset the EXIF orientation.
+			if exif.Orientation > 1 {
+				options = append(options, libheif.WithImageOrientation(libheif.Orientation(exif.Orientation)))
+			}
+			options = append(options, libheif.WithExif(exif), libheif.NormalizeOrientation())
+		}
+	}
+
+	ctx, _, err := libheif.EncodeFromImageWithOptions(convertImage(img), compression, options...)
+	if err != nil {
+		return err
+	}
+
+	filename := outputFilename(input, compression)
+	if err := ctx.WriteToFile(filename); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+
+	fmt.Printf("Written to %s\n", filename)
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <input.png|input.jpg|input.gif> [<input>...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *listParams {
+		if err := printParameters(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *output != "" && flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "-o can only be used with a single input")
+		os.Exit(2)
+	}
+
+	format, err := compressionFormat()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, input := range flag.Args() {
+		if err := run(input, format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,329 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/strukturag/libheif-go"
+)
+
+var (
+	jsonOutput = flag.Bool("json", false, "print information as JSON")
+)
+
+var colorspaceNames = map[libheif.Colorspace]string{
+	libheif.ColorspaceYCbCr:      "YCbCr",
+	libheif.ColorspaceRGB:        "RGB",
+	libheif.ColorspaceMonochrome: "monochrome",
+}
+
+var chromaNames = map[libheif.Chroma]string{
+	libheif.ChromaMonochrome: "monochrome",
+	libheif.Chroma420:        "4:2:0",
+	libheif.Chroma422:        "4:2:2",
+	libheif.Chroma444:        "4:4:4",
+}
+
+type metadataInfo struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	ContentType string `json:"content_type,omitempty"`
+	URI         string `json:"uri,omitempty"`
+	Size        int    `json:"size"`
+}
+
+type imageInfo struct {
+	ID                 int            `json:"id"`
+	Primary            bool           `json:"primary,omitempty"`
+	AuxiliaryType      string         `json:"auxiliary_type,omitempty"`
+	Width              int            `json:"width"`
+	Height             int            `json:"height"`
+	LumaBitDepth       int            `json:"luma_bit_depth"`
+	ChromaBitDepth     int            `json:"chroma_bit_depth"`
+	Colorspace         string         `json:"colorspace,omitempty"`
+	Chroma             string         `json:"chroma,omitempty"`
+	Alpha              bool           `json:"alpha"`
+	PremultipliedAlpha bool           `json:"premultiplied_alpha,omitempty"`
+	ColorProfile       string         `json:"color_profile"`
+	NCLX               bool           `json:"nclx"`
+	ICCSize            int            `json:"icc_size,omitempty"`
+	Thumbnails         []imageInfo    `json:"thumbnails,omitempty"`
+	DepthImages        []imageInfo    `json:"depth_images,omitempty"`
+	AuxiliaryImages    []imageInfo    `json:"auxiliary_images,omitempty"`
+	Metadata           []metadataInfo `json:"metadata,omitempty"`
+}
+
+type fileInfo struct {
+	Filename         string      `json:"filename"`
+	MimeType         string      `json:"mime_type"`
+	MainBrand        string      `json:"main_brand"`
+	CompatibleBrands []string    `json:"compatible_brands"`
+	Images           []imageInfo `json:"images"`
+}
+
+func getImageInfo(handle *libheif.ImageHandle) (imageInfo, error) {
+	info := imageInfo{
+		ID:                 handle.GetItemID(),
+		Width:              handle.GetWidth(),
+		Height:             handle.GetHeight(),
+		LumaBitDepth:       handle.GetLumaBitsPerPixel(),
+		ChromaBitDepth:     handle.GetChromaBitsPerPixel(),
+		Alpha:              handle.HasAlphaChannel(),
+		PremultipliedAlpha: handle.IsPremultipliedAlpha(),
+		ColorProfile:       handle.GetColorProfileType().String(),
+		NCLX:               handle.HasNCLXColorProfile(),
+	}
+
+	if colorspace, chroma, err := handle.GetPreferredDecodingColorspace(); err == nil {
+		info.Colorspace = colorspaceNames[colorspace]
+		info.Chroma = chromaNames[chroma]
+	}
+
+	icc, err := handle.GetRawColorProfile()
+	if err != nil {
+		return info, fmt.Errorf("failed to get color profile of image %d: %w", info.ID, err)
+	}
+	info.ICCSize = len(icc)
+
+	for _, id := range handle.GetListOfThumbnailIDs() {
+		thumbnail, err := handle.GetThumbnail(id)
+		if err != nil {
+			return info, fmt.Errorf("failed to get thumbnail %d: %w", id, err)
+		}
+
+		thumbnailInfo, err := getImageInfo(thumbnail)
+		if err != nil {
+			return info, err
+		}
+		info.Thumbnails = append(info.Thumbnails, thumbnailInfo)
+	}
+
+	for _, id := range handle.GetListOfDepthImageIDs() {
+		depth, err := handle.GetDepthImageHandle(id)
+		if err != nil {
+			return info, fmt.Errorf("failed to get depth image %d: %w", id, err)
+		}
+
+		depthInfo, err := getImageInfo(depth)
+		if err != nil {
+			return info, err
+		}
+		info.DepthImages = append(info.DepthImages, depthInfo)
+	}
+
+	for _, id := range handle.GetListOfAuxiliaryImageIDs() {
+		aux, err := handle.GetAuxiliaryImageHandle(id)
+		if err != nil {
+			return info, fmt.Errorf("failed to get auxiliary image %d: %w", id, err)
+		}
+
+		auxInfo, err := getImageInfo(aux)
+		if err != nil {
+			return info, err
+		}
+		if auxInfo.AuxiliaryType, err = aux.GetAuxiliaryType(); err != nil {
+			return info, fmt.Errorf("failed to get type of auxiliary image %d: %w", id, err)
+		}
+		info.AuxiliaryImages = append(info.AuxiliaryImages, auxInfo)
+	}
+
+	for _, id := range handle.GetMetadataBlockIDs("") {
+		data, err := handle.GetMetadata(id)
+		if err != nil {
+			return info, fmt.Errorf("failed to get metadata block %d: %w", id, err)
+		}
+
+		info.Metadata = append(info.Metadata, metadataInfo{
+			ID:          id,
+			Type:        handle.GetMetadataItemType(id),
+			ContentType: handle.GetMetadataContentType(id),
+			URI:         handle.GetMetadataItemURIType(id),
+			Size:        len(data),
+		})
+	}
+
+	return info, nil
+}
+
+func getFileInfo(filename string) (*fileInfo, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &fileInfo{
+		Filename:  filename,
+		MimeType:  libheif.GetFileMimeType(data),
+		MainBrand: libheif.ReadMainBrand(data),
+	}
+	if info.CompatibleBrands, err = libheif.ListCompatibleBrands(data); err != nil {
+		return nil, fmt.Errorf("failed to read brands: %w", err)
+	}
+
+	ctx, err := libheif.NewContext()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.ReadFromMemory(data); err != nil {
+		return nil, err
+	}
+
+	primaryID, err := ctx.GetPrimaryImageID()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ctx.GetListOfTopLevelImageIDs() {
+		handle, err := ctx.GetImageHandle(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image %d: %w", id, err)
+		}
+
+		imageInfo, err := getImageInfo(handle)
+		if err != nil {
+			return nil, err
+		}
+		imageInfo.Primary = id == primaryID
+		info.Images = append(info.Images, imageInfo)
+	}
+
+	return info, nil
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func printImageInfo(w io.Writer, info *imageInfo, kind string, indent string) {
+	primary := ""
+	if info.Primary {
+		primary = ", primary"
+	}
+	fmt.Fprintf(w, "%s%s: %dx%d (id=%d)%s\n", indent, kind, info.Width, info.Height, info.ID, primary)
+	indent += "  "
+	if info.AuxiliaryType != "" {
+		fmt.Fprintf(w, "%stype: %s\n", indent, info.AuxiliaryType)
+	}
+	if info.Colorspace != "" {
+		fmt.Fprintf(w, "%scolorspace: %s, %s\n", indent, info.Colorspace, info.Chroma)
+	}
+	fmt.Fprintf(w, "%sbit depth: %d (luma), %d (chroma)\n", indent, info.LumaBitDepth, info.ChromaBitDepth)
+	alpha := yesNo(info.Alpha)
+	if info.PremultipliedAlpha {
+		alpha += " (premultiplied)"
+	}
+	fmt.Fprintf(w, "%salpha channel: %s\n", indent, alpha)
+	profile := info.ColorProfile
+	if info.ICCSize > 0 {
+		profile += fmt.Sprintf(" (%d bytes)", info.ICCSize)
+	}
+	if info.NCLX && info.ColorProfile != libheif.ColorProfileTypeNCLX.String() {
+		profile += ", nclx"
+	}
+	fmt.Fprintf(w, "%scolor profile: %s\n", indent, profile)
+
+	for _, m := range info.Metadata {
+		desc := m.Type
+		if m.ContentType != "" {
+			desc += " " + m.ContentType
+		}
+		if m.URI != "" {
+			desc += " " + m.URI
+		}
+		fmt.Fprintf(w, "%smetadata: %s (id=%d, %d bytes)\n", indent, desc, m.ID, m.Size)
+	}
+	for i := range info.Thumbnails {
+		printImageInfo(w, &info.Thumbnails[i], "thumbnail", indent)
+	}
+	for i := range info.DepthImages {
+		printImageInfo(w, &info.DepthImages[i], "depth image", indent)
+	}
+	for i := range info.AuxiliaryImages {
+		printImageInfo(w, &info.AuxiliaryImages[i], "auxiliary image", indent)
+	}
+}
+
+func printFileInfo(w io.Writer, info *fileInfo) {
+	fmt.Fprintf(w, "file: %s\n", info.Filename)
+	fmt.Fprintf(w, "MIME type: %s\n", info.MimeType)
+	fmt.Fprintf(w, "main brand: %s\n", info.MainBrand)
+	fmt.Fprintf(w, "compatible brands: %s\n", strings.Join(info.CompatibleBrands, ", "))
+	for i := range info.Images {
+		printImageInfo(w, &info.Images[i], "image", "")
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <filename> [<filename>...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	infos := []*fileInfo{}
+	for _, filename := range flag.Args() {
+		info, err := getFileInfo(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read %s: %s\n", filename, err)
+			failed = true
+			continue
+		}
+
+		if *jsonOutput {
+			infos = append(infos, info)
+			continue
+		}
+
+		if len(infos) > 0 {
+			fmt.Println()
+		}
+		printFileInfo(os.Stdout, info)
+		infos = append(infos, info)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(infos); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write JSON: %s\n", err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
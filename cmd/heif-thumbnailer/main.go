@@ -0,0 +1,159 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+//go:generate sh -c "go run . -print-thumbnailer > heif.thumbnailer"
+
+// Command heif-thumbnailer creates PNG thumbnails of HEIF images and can be
+// used as thumbnailer for freedesktop compatible desktop environments.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+
+	"github.com/strukturag/libheif-go"
+)
+
+const thumbnailerEntry = `[Thumbnailer Entry]
+TryExec=heif-thumbnailer
+Exec=heif-thumbnailer -s %s %i %o
+MimeType=image/heic;image/heif;image/heic-sequence;image/heif-sequence;image/avif;
+`
+
+var (
+	size             = flag.Int("s", 256, "maximum width and height of the thumbnail")
+	printThumbnailer = flag.Bool("print-thumbnailer", false, "print the freedesktop .thumbnailer file and exit")
+)
+
+// selectImage returns the smallest embedded thumbnail that is at least as
+// large as the requested size or the image itself.
+func selectImage(handle *libheif.ImageHandle, size int) (*libheif.ImageHandle, error) {
+	result := handle
+	for _, id := range handle.GetListOfThumbnailIDs() {
+		thumbnail, err := handle.GetThumbnail(id)
+		if err != nil {
+			return nil, fmt.Errorf("could not get thumbnail %d: %w", id, err)
+		}
+
+		if max(thumbnail.GetWidth(), thumbnail.GetHeight()) < size {
+			continue
+		}
+
+		if thumbnail.GetWidth()*thumbnail.GetHeight() < result.GetWidth()*result.GetHeight() {
+			result = thumbnail
+		}
+	}
+	return result, nil
+}
+
+// fitSize returns the size of an image scaled to fit into a square of the
+// given size, keeping the aspect ratio. Images are never enlarged.
+func fitSize(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+
+	return max(1, width*size/height), size
+}
+
+func run(input string, output string) error {
+	ctx, err := libheif.NewContext()
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.ReadFromFile(input); err != nil {
+		return fmt.Errorf("could not read %s: %w", input, err)
+	}
+
+	primary, err := ctx.GetPrimaryImageHandle()
+	if err != nil {
+		return fmt.Errorf("could not get primary image: %w", err)
+	}
+
+	handle, err := selectImage(primary, *size)
+	if err != nil {
+		return err
+	}
+
+	chroma := libheif.ChromaInterleavedRGB
+	if handle.HasAlphaChannel() {
+		chroma = libheif.ChromaInterleavedRGBA
+	}
+
+	// Transformations like rotation are applied while decoding.
+	img, err := handle.DecodeImage(libheif.ColorspaceRGB, chroma, nil)
+	if err != nil {
+		return fmt.Errorf("could not decode image: %w", err)
+	}
+
+	width := img.GetWidth(libheif.ChannelInterleaved)
+	height := img.GetHeight(libheif.ChannelInterleaved)
+	if w, h := fitSize(width, height, *size); w != width || h != height {
+		if img, err = img.ScaleImage(w, h); err != nil {
+			return fmt.Errorf("could not scale image: %w", err)
+		}
+	}
+
+	thumbnail, err := img.GetImage()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, thumbnail); err != nil {
+		f.Close() // nolint
+		return fmt.Errorf("could not write %s: %w", output, err)
+	}
+
+	return f.Close()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <input> <output.png>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printThumbnailer {
+		fmt.Printf("%s", thumbnailerEntry)
+		return
+	}
+
+	if flag.NArg() != 2 || *size <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
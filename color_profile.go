@@ -0,0 +1,102 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// ColorProfileType is the type of a color profile.
+type ColorProfileType C.enum_heif_color_profile_type
+
+const (
+	ColorProfileTypeNotPresent ColorProfileType = C.heif_color_profile_type_not_present
+	ColorProfileTypeNCLX       ColorProfileType = C.heif_color_profile_type_nclx
+	ColorProfileTypeRICC       ColorProfileType = C.heif_color_profile_type_rICC
+	ColorProfileTypeProf       ColorProfileType = C.heif_color_profile_type_prof
+)
+
+// String returns the four character code of the profile type.
+func (t ColorProfileType) String() string {
+	if t == ColorProfileTypeNotPresent {
+		return "none"
+	}
+
+	return string([]byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)})
+}
+
+// GetColorProfileType returns the type of the color profile of the image. If
+// the image has both an ICC and an nclx profile, the ICC type is returned.
+func (h *ImageHandle) GetColorProfileType() ColorProfileType {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return ColorProfileTypeNotPresent
+	}
+
+	return ColorProfileType(C.heif_image_handle_get_color_profile_type(h.handle))
+}
+
+// HasNCLXColorProfile checks if the image has an nclx color profile.
+func (h *ImageHandle) HasNCLXColorProfile() bool {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return false
+	}
+
+	var nclx *C.struct_heif_color_profile_nclx
+	if err := C.heif_image_handle_get_nclx_color_profile(h.handle, &nclx); err.code != C.heif_error_Ok {
+		return false
+	}
+
+	C.heif_nclx_color_profile_free(nclx)
+	return true
+}
+
+// GetRawColorProfile returns the ICC color profile of the image or nil if the
+// image has no ICC profile.
+func (h *ImageHandle) GetRawColorProfile() ([]byte, error) {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	size := C.heif_image_handle_get_raw_color_profile_size(h.handle)
+	if size == 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, size)
+	err := C.heif_image_handle_get_raw_color_profile(h.handle, unsafe.Pointer(&data[0]))
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
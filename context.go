@@ -48,13 +48,37 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"runtime"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
-// Context is a libheif context.
+// defaultMaxDecodingThreads stores the default number of decoding threads
+// plus one, so the zero value keeps the default of libheif.
+var defaultMaxDecodingThreads atomic.Int64
+
+// SetDefaultMaxDecodingThreads sets the maximum number of threads that
+// contexts created afterwards use to decode images, e.g. the tiles of a grid
+// image. With 0 threads, images are decoded in the calling goroutine. Pass a
+// negative value to restore the default of libheif.
+func SetDefaultMaxDecodingThreads(n int) {
+	defaultMaxDecodingThreads.Store(int64(max(n, -1) + 1))
+}
+
+// GetDefaultMaxDecodingThreads returns the maximum number of threads that new
+// contexts use to decode images, or -1 if the default of libheif is used.
+func GetDefaultMaxDecodingThreads() int {
+	return int(defaultMaxDecodingThreads.Load()) - 1
+}
+
+// Context is a libheif context. A context and the image handles returned by
+// it must not be used by multiple goroutines at the same time, different
+// contexts can be used concurrently.
 type Context struct {
-	context *C.struct_heif_context
+	context     *C.struct_heif_context
+	compression CompressionFormat // reported to the Observer
 }
 
 // NewContext creates a new libheif context that can be used for decoding and
@@ -71,33 +95,141 @@ func NewContext() (*Context, error) {
 		return nil, errors.New("Could not allocate context")
 	}
 
+	if n := GetDefaultMaxDecodingThreads(); n >= 0 {
+		C.heif_context_set_max_decoding_threads(ctx.context, C.int(n))
+	}
+
 	runtime.SetFinalizer(ctx, freeHeifContext)
 	return ctx, nil
 }
 
 func freeHeifContext(c *Context) {
+	if c.context == nil {
+		return
+	}
+
 	C.heif_context_free(c.context)
 	c.context = nil
 }
 
+// Close releases the context immediately instead of waiting for the garbage
+// collector. Image handles of the context can still be decoded afterwards,
+// but reading their item properties, e.g. with GetTransformations, fails
+// with ErrClosed. It is safe to call Close multiple times, other methods fail
+// with ErrClosed after the context has been closed.
+func (c *Context) Close() {
+	runtime.SetFinalizer(c, nil)
+	freeHeifContext(c)
+}
+
+// SetMaxDecodingThreads sets the maximum number of threads that are used to
+// decode images of the context, e.g. the tiles of a grid image. With 0
+// threads, images are decoded in the calling goroutine.
+func (c *Context) SetMaxDecodingThreads(n int) error {
+	defer runtime.KeepAlive(c)
+
+	if c.context == nil {
+		return ErrClosed
+	}
+
+	if n < 0 {
+		return fmt.Errorf("invalid number of decoding threads %d", n)
+	}
+
+	C.heif_context_set_max_decoding_threads(c.context, C.int(n))
+	return nil
+}
+
 // ReadFromFile loads the image from the given filename in the current context.
 func (c *Context) ReadFromFile(filename string) error {
+	start := time.Now()
+	err := c.readFromFile(filename)
+	observe(start, func() Event {
+		var size int64
+		if fi, err := os.Stat(filename); err == nil {
+			size = fi.Size()
+		}
+		return Event{
+			Operation:   OperationRead,
+			Compression: c.compression,
+			Bytes:       size,
+			Err:         err,
+		}
+	})
+	return err
+}
+
+func (c *Context) readFromFile(filename string) error {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return ErrClosed
+	}
+
 	c_filename := C.CString(filename)
 	defer C.free(unsafe.Pointer(c_filename))
 
 	err := C.heif_context_read_from_file(c.context, c_filename, nil)
-	return convertHeifError(err)
+	if err := convertHeifError(err); err != nil {
+		return err
+	}
+
+	c.compression = detectFileCompression(filename)
+	return nil
+}
+
+// fileHeaderSize is the number of bytes that are read to detect the
+// compression format from the brands of a file.
+const fileHeaderSize = 4096
+
+// detectFileCompression returns the compression format of a file based on
+// the brands in its header.
+func detectFileCompression(filename string) CompressionFormat {
+	f, err := os.Open(filename)
+	if err != nil {
+		return CompressionUndefined
+	}
+	defer f.Close()
+
+	header := make([]byte, fileHeaderSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return CompressionUndefined
+	}
+
+	return detectCompression(header[:n])
 }
 
 // ReadFromMemory loads the image from the given data in the current context.
 func (c *Context) ReadFromMemory(data []byte) error {
+	start := time.Now()
+	err := c.readFromMemory(data)
+	observe(start, func() Event {
+		return Event{
+			Operation:   OperationRead,
+			Compression: c.compression,
+			Bytes:       int64(len(data)),
+			Err:         err,
+		}
+	})
+	return err
+}
+
+func (c *Context) readFromMemory(data []byte) error {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return ErrClosed
+	}
+
 	// TODO: Use reader API internally.
 	err := C.heif_context_read_from_memory(c.context, unsafe.Pointer(&data[0]), C.size_t(len(data)), nil)
-	return convertHeifError(err)
+	if err := convertHeifError(err); err != nil {
+		return err
+	}
+
+	c.compression = detectCompression(data)
+	return nil
 }
 
 func (c *Context) convertEncoderDescriptor(d *C.struct_heif_encoder_descriptor) (*Encoder, error) {
@@ -106,8 +238,9 @@ func (c *Context) convertEncoderDescriptor(d *C.struct_heif_encoder_descriptor)
 	cid := C.heif_encoder_descriptor_get_id_name(d)
 	cname := C.heif_encoder_descriptor_get_name(d)
 	enc := &Encoder{
-		id:   C.GoString(cid),
-		name: C.GoString(cname),
+		id:     C.GoString(cid),
+		name:   C.GoString(cname),
+		format: CompressionFormat(C.heif_encoder_descriptor_get_compression_format(d)),
 	}
 	err := C.heif_context_get_encoder(c.context, d, &enc.encoder)
 	if err := convertHeifError(err); err != nil {
@@ -122,6 +255,10 @@ func (c *Context) convertEncoderDescriptor(d *C.struct_heif_encoder_descriptor)
 func (c *Context) NewEncoder(compression CompressionFormat) (*Encoder, error) {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return nil, ErrClosed
+	}
+
 	const max = 1
 	descriptors := make([]*C.struct_heif_encoder_descriptor, max)
 	num := int(C.heif_context_get_encoder_descriptors(c.context, uint32(compression), nil, &descriptors[0], C.int(max)))
@@ -132,10 +269,130 @@ func (c *Context) NewEncoder(compression CompressionFormat) (*Encoder, error) {
 	return c.convertEncoderDescriptor(descriptors[0])
 }
 
+// EncodeImage encodes the given image with the encoder and adds it to the
+// current context. The options are optional and can be nil.
+func (c *Context) EncodeImage(img *Image, encoder *Encoder, options *EncodingOptions) (*ImageHandle, error) {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(img)
+	defer runtime.KeepAlive(encoder)
+	defer runtime.KeepAlive(options)
+
+	if c.context == nil || img.image == nil || encoder.encoder == nil {
+		return nil, ErrClosed
+	}
+
+	var opt *C.struct_heif_encoding_options
+	if options != nil {
+		if options.options == nil {
+			return nil, ErrClosed
+		}
+		opt = options.options
+	}
+
+	handle := ImageHandle{
+		ctx: c,
+	}
+	err := C.heif_context_encode_image(c.context, img.image, encoder.encoder, opt, &handle.handle)
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+
+	if c.compression == CompressionUndefined {
+		c.compression = encoder.format
+	}
+
+	runtime.SetFinalizer(&handle, freeHeifImageHandle)
+	return &handle, nil
+}
+
+// EncodeThumbnail encodes a thumbnail of the image that fits into a square of
+// bboxSize pixels and assigns it to the master image. No thumbnail is created
+// and nil is returned if the image is not larger than bboxSize.
+func (c *Context) EncodeThumbnail(img *Image, master *ImageHandle, encoder *Encoder, options *EncodingOptions, bboxSize int) (*ImageHandle, error) {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(img)
+	defer runtime.KeepAlive(master)
+	defer runtime.KeepAlive(encoder)
+	defer runtime.KeepAlive(options)
+
+	if c.context == nil || img.image == nil || master.handle == nil || encoder.encoder == nil {
+		return nil, ErrClosed
+	}
+
+	var opt *C.struct_heif_encoding_options
+	if options != nil {
+		if options.options == nil {
+			return nil, ErrClosed
+		}
+		opt = options.options
+	}
+
+	handle := ImageHandle{
+		ctx: c,
+	}
+	err := C.heif_context_encode_thumbnail(c.context, img.image, master.handle, encoder.encoder, opt, C.int(bboxSize), &handle.handle)
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+
+	if handle.handle == nil {
+		return nil, nil
+	}
+
+	runtime.SetFinalizer(&handle, freeHeifImageHandle)
+	return &handle, nil
+}
+
+// SetPrimaryImage marks the given image as primary image of the context.
+func (c *Context) SetPrimaryImage(handle *ImageHandle) error {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	err := C.heif_context_set_primary_image(c.context, handle.handle)
+	return convertHeifError(err)
+}
+
+// AssignThumbnail assigns an encoded image as thumbnail of the master image.
+func (c *Context) AssignThumbnail(master *ImageHandle, thumbnail *ImageHandle) error {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(master)
+	defer runtime.KeepAlive(thumbnail)
+
+	if c.context == nil || master.handle == nil || thumbnail.handle == nil {
+		return ErrClosed
+	}
+
+	err := C.heif_context_assign_thumbnail(c.context, master.handle, thumbnail.handle)
+	return convertHeifError(err)
+}
+
 // Write saves the current image.
 func (c *Context) Write(w io.Writer) error {
+	start := time.Now()
+	written, err := c.write(w)
+	observe(start, func() Event {
+		return Event{
+			Operation:   OperationWrite,
+			Compression: c.compression,
+			Bytes:       written,
+			Err:         err,
+		}
+	})
+	return err
+}
+
+// write saves the current image and returns the number of bytes written.
+func (c *Context) write(w io.Writer) (int64, error) {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return 0, ErrClosed
+	}
+
 	writer := &C.struct_heif_writer{
 		writer_api_version: 1,
 
@@ -152,16 +409,20 @@ func (c *Context) Write(w io.Writer) error {
 	err := C.heif_context_write(c.context, writer, unsafe.Pointer(writerData))
 	if writerData.err != nil {
 		// Bubble up error returned by passed io.Writer
-		return writerData.err
+		return writerData.written, writerData.err
 	}
 
-	return convertHeifError(err)
+	return writerData.written, convertHeifError(err)
 }
 
 // WriteToFile saves the current image to the given file.
 func (c *Context) WriteToFile(filename string) error {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_context_write_to_file(c.context, C.CString(filename))
 	return convertHeifError(err)
 }
@@ -170,6 +431,10 @@ func (c *Context) WriteToFile(filename string) error {
 func (c *Context) GetNumberOfTopLevelImages() int {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return 0
+	}
+
 	i := int(C.heif_context_get_number_of_top_level_images(c.context))
 	return i
 }
@@ -178,6 +443,10 @@ func (c *Context) GetNumberOfTopLevelImages() int {
 func (c *Context) IsTopLevelImageID(ID int) bool {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return false
+	}
+
 	ok := C.heif_context_is_top_level_image_ID(c.context, C.heif_item_id(ID)) != 0
 	return ok
 }
@@ -186,6 +455,10 @@ func (c *Context) IsTopLevelImageID(ID int) bool {
 func (c *Context) GetListOfTopLevelImageIDs() []int {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return []int{}
+	}
+
 	num := int(C.heif_context_get_number_of_top_level_images(c.context))
 	if num == 0 {
 		return []int{}
@@ -200,6 +473,10 @@ func (c *Context) GetListOfTopLevelImageIDs() []int {
 func (c *Context) GetPrimaryImageID() (int, error) {
 	defer runtime.KeepAlive(c)
 
+	if c.context == nil {
+		return 0, ErrClosed
+	}
+
 	var id C.heif_item_id
 	err := C.heif_context_get_primary_image_ID(c.context, &id)
 	if err := convertHeifError(err); err != nil {
@@ -213,7 +490,13 @@ func (c *Context) GetPrimaryImageID() (int, error) {
 func (c *Context) GetPrimaryImageHandle() (*ImageHandle, error) {
 	defer runtime.KeepAlive(c)
 
-	var handle ImageHandle
+	if c.context == nil {
+		return nil, ErrClosed
+	}
+
+	handle := ImageHandle{
+		ctx: c,
+	}
 	err := C.heif_context_get_primary_image_handle(c.context, &handle.handle)
 	if err := convertHeifError(err); err != nil {
 		return nil, err
@@ -227,7 +510,13 @@ func (c *Context) GetPrimaryImageHandle() (*ImageHandle, error) {
 func (c *Context) GetImageHandle(id int) (*ImageHandle, error) {
 	defer runtime.KeepAlive(c)
 
-	var handle ImageHandle
+	if c.context == nil {
+		return nil, ErrClosed
+	}
+
+	handle := ImageHandle{
+		ctx: c,
+	}
 	err := C.heif_context_get_image_handle(c.context, C.heif_item_id(id), &handle.handle)
 	if err := convertHeifError(err); err != nil {
 		return nil, err
@@ -238,8 +527,16 @@ func (c *Context) GetImageHandle(id int) (*ImageHandle, error) {
 }
 
 func (c *Context) AddExifMetadata(handle *ImageHandle, data []byte) error {
-	runtime.KeepAlive(c)
-	runtime.KeepAlive(handle)
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	if len(data) == 0 {
+		return errors.New("no metadata to add")
+	}
 
 	dataPtr := unsafe.Pointer(&data[0])
 	err := C.heif_context_add_exif_metadata(c.context, handle.handle, dataPtr, C.int(len(data)))
@@ -247,8 +544,16 @@ func (c *Context) AddExifMetadata(handle *ImageHandle, data []byte) error {
 }
 
 func (c *Context) AddXmpMetadata(handle *ImageHandle, data []byte) error {
-	runtime.KeepAlive(c)
-	runtime.KeepAlive(handle)
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	if len(data) == 0 {
+		return errors.New("no metadata to add")
+	}
 
 	dataPtr := unsafe.Pointer(&data[0])
 	err := C.heif_context_add_XMP_metadata(c.context, handle.handle, dataPtr, C.int(len(data)))
@@ -256,8 +561,16 @@ func (c *Context) AddXmpMetadata(handle *ImageHandle, data []byte) error {
 }
 
 func (c *Context) AddGenericMetadata(handle *ImageHandle, data []byte, item_type string, content_type string) error {
-	runtime.KeepAlive(c)
-	runtime.KeepAlive(handle)
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	if len(data) == 0 {
+		return errors.New("no metadata to add")
+	}
 
 	dataPtr := unsafe.Pointer(&data[0])
 	var it *C.char
@@ -273,3 +586,23 @@ func (c *Context) AddGenericMetadata(handle *ImageHandle, data []byte, item_type
 	err := C.heif_context_add_generic_metadata(c.context, handle.handle, dataPtr, C.int(len(data)), it, ct)
 	return convertHeifError(err)
 }
+
+// AddGenericURIMetadata adds metadata with item type "uri " and the given URI
+// to the image.
+func (c *Context) AddGenericURIMetadata(handle *ImageHandle, data []byte, uri string) error {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	if len(data) == 0 {
+		return errors.New("no metadata to add")
+	}
+
+	u := C.CString(uri)
+	defer C.free(unsafe.Pointer(u))
+	err := C.heif_context_add_generic_uri_metadata(c.context, handle.handle, unsafe.Pointer(&data[0]), C.int(len(data)), u, nil)
+	return convertHeifError(err)
+}
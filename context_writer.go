@@ -32,8 +32,9 @@ import (
 )
 
 type writerData struct {
-	w   io.Writer
-	err error
+	w       io.Writer
+	written int64
+	err     error
 }
 
 //export writeGo
@@ -46,7 +47,8 @@ func writeGo(data *C.void, size C.size_t, userdata *C.void) C.struct_heif_error
 		}
 	}
 
-	_, err := writer.w.Write(C.GoBytes(unsafe.Pointer(data), C.int(size)))
+	n, err := writer.w.Write(C.GoBytes(unsafe.Pointer(data), C.int(size)))
+	writer.written += int64(n)
 	if err != nil {
 		writer.err = err
 		return C.struct_heif_error{
@@ -37,6 +37,10 @@ type DecodingOptions struct {
 }
 
 func freeHeifDecodingOptions(options *DecodingOptions) {
+	if options.options == nil {
+		return
+	}
+
 	if options.options.decoder_id != nil {
 		C.free(unsafe.Pointer(options.options.decoder_id))
 	}
@@ -44,6 +48,14 @@ func freeHeifDecodingOptions(options *DecodingOptions) {
 	options.options = nil
 }
 
+// Close releases the options immediately instead of waiting for the garbage
+// collector. It is safe to call Close multiple times. Closed options can no
+// longer be modified and make decoding fail with ErrClosed.
+func (o *DecodingOptions) Close() {
+	runtime.SetFinalizer(o, nil)
+	freeHeifDecodingOptions(o)
+}
+
 // NewDecodingOptions creates new decoding options.
 func NewDecodingOptions() (*DecodingOptions, error) {
 	if err := checkLibraryVersion(); err != nil {
@@ -66,24 +78,40 @@ func NewDecodingOptions() (*DecodingOptions, error) {
 // SetIgnoreTransformations sets whether geometric transformations like
 // cropping, rotation, mirroring should be ignored.
 func (o *DecodingOptions) SetIgnoreTransformations(ignore bool) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.ignore_transformations = convertBool[C.uchar](ignore)
 }
 
 // GetIgnoreTransformations returns true if geometric transformations like
 // cropping, rotation, mirroring should be ignored.
 func (o *DecodingOptions) GetIgnoreTransformations() bool {
+	if o.options == nil {
+		return false
+	}
+
 	return o.options.ignore_transformations != 0
 }
 
 // SetConvertHDRTo8Bit defines whether HDR images should be converted to 8bit
 // during decoding.
 func (o *DecodingOptions) SetConvertHDRTo8Bit(convert bool) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.convert_hdr_to_8bit = convertBool[C.uchar](convert)
 }
 
 // GetConvertHDRTo8Bit returns true if HDR images will be converted to 8bit
 // during decoding.
 func (o *DecodingOptions) GetConvertHDRTo8Bit() bool {
+	if o.options == nil {
+		return false
+	}
+
 	return o.options.convert_hdr_to_8bit != 0
 }
 
@@ -91,11 +119,19 @@ func (o *DecodingOptions) GetConvertHDRTo8Bit() bool {
 // invalid input. Otherwise, it will try its best and add decoding warnings
 // to the decoded heif_image. Default is non-strict.
 func (o *DecodingOptions) SetStrictDecoding(strict bool) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.strict_decoding = convertBool[C.uchar](strict)
 }
 
 // GetStrictDecoding returns true if strict decoding is enabled.
 func (o *DecodingOptions) GetStrictDecoding() bool {
+	if o.options == nil {
+		return false
+	}
+
 	return o.options.strict_decoding != 0
 }
 
@@ -103,6 +139,10 @@ func (o *DecodingOptions) GetStrictDecoding() bool {
 // (the default), the highest priority decoder is chosen.
 // The priority is defined in the plugin.
 func (o *DecodingOptions) SetDecoderId(decoder string) {
+	if o.options == nil {
+		return
+	}
+
 	if o.options.decoder_id != nil {
 		C.free(unsafe.Pointer(o.options.decoder_id))
 	}
@@ -116,6 +156,10 @@ func (o *DecodingOptions) SetDecoderId(decoder string) {
 
 // GetDecoderId returns the decoder id that should be used.
 func (o *DecodingOptions) GetDecoderId() string {
+	if o.options == nil {
+		return ""
+	}
+
 	if o.options.decoder_id == nil {
 		return ""
 	}
@@ -125,21 +169,37 @@ func (o *DecodingOptions) GetDecoderId() string {
 
 // SetChromaDownsamplingAlgorithm sets the chroma downsampling algorithm to use.
 func (o *DecodingOptions) SetChromaDownsamplingAlgorithm(algorithm ChromaDownsamplingAlgorithm) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.color_conversion_options.preferred_chroma_downsampling_algorithm = uint32(algorithm)
 }
 
 // GetChromaDownsamplingAlgorithm returns the chroma downsampling algorithm to use.
 func (o *DecodingOptions) GetChromaDownsamplingAlgorithm() ChromaDownsamplingAlgorithm {
+	if o.options == nil {
+		return ChromaDownsamplingAlgorithm(0)
+	}
+
 	return ChromaDownsamplingAlgorithm(o.options.color_conversion_options.preferred_chroma_downsampling_algorithm)
 }
 
 // SetChromaUpsamplingAlgorithm sets the chroma upsampling algorithm to use.
 func (o *DecodingOptions) SetChromaUpsamplingAlgorithm(algorithm ChromaUpsamplingAlgorithm) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.color_conversion_options.preferred_chroma_upsampling_algorithm = uint32(algorithm)
 }
 
 // GetChromaUpsamplingAlgorithm returns the chroma upsampling algorithm to use.
 func (o *DecodingOptions) GetChromaUpsamplingAlgorithm() ChromaUpsamplingAlgorithm {
+	if o.options == nil {
+		return ChromaUpsamplingAlgorithm(0)
+	}
+
 	return ChromaUpsamplingAlgorithm(o.options.color_conversion_options.preferred_chroma_upsampling_algorithm)
 }
 
@@ -147,10 +207,18 @@ func (o *DecodingOptions) GetChromaUpsamplingAlgorithm() ChromaUpsamplingAlgorit
 // If set to false, libheif may also use a different algorithm if the preferred
 // one is not available.
 func (o *DecodingOptions) SetOnlyUsePreferredChromaAlgorithm(preferred bool) {
+	if o.options == nil {
+		return
+	}
+
 	o.options.color_conversion_options.only_use_preferred_chroma_algorithm = convertBool[C.uchar](preferred)
 }
 
 // GetOnlyUsePreferredChromaAlgorithm returns true if only the preferred chroma algorithm should be used
 func (o *DecodingOptions) GetOnlyUsePreferredChromaAlgorithm() bool {
+	if o.options == nil {
+		return false
+	}
+
 	return o.options.color_conversion_options.only_use_preferred_chroma_algorithm != 0
 }
@@ -256,3 +256,16 @@ const (
 	EncoderParameterTypeBoolean EncoderParameterType = C.heif_encoder_parameter_type_boolean
 	EncoderParameterTypeString  EncoderParameterType = C.heif_encoder_parameter_type_string
 )
+
+type Orientation C.enum_heif_orientation
+
+const (
+	OrientationNormal                         Orientation = C.heif_orientation_normal
+	OrientationFlipHorizontally               Orientation = C.heif_orientation_flip_horizontally
+	OrientationRotate180                      Orientation = C.heif_orientation_rotate_180
+	OrientationFlipVertically                 Orientation = C.heif_orientation_flip_vertically
+	OrientationRotate90CwThenFlipHorizontally Orientation = C.heif_orientation_rotate_90_cw_then_flip_horizontally
+	OrientationRotate90Cw                     Orientation = C.heif_orientation_rotate_90_cw
+	OrientationRotate90CwThenFlipVertically   Orientation = C.heif_orientation_rotate_90_cw_then_flip_vertically
+	OrientationRotate270Cw                    Orientation = C.heif_orientation_rotate_270_cw
+)
@@ -0,0 +1,161 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// compressionFormats are the formats that are checked when listing decoders
+// for all formats.
+var compressionFormats = []CompressionFormat{
+	CompressionHEVC,
+	CompressionAVC,
+	CompressionJPEG,
+	CompressionAV1,
+	CompressionVVC,
+	CompressionEVC,
+	CompressionJPEG2000,
+	CompressionUncompressed,
+}
+
+// DecoderDescriptor describes a decoder that is available in libheif.
+type DecoderDescriptor struct {
+	// ID can be passed to DecodingOptions.SetDecoderId.
+	ID   string
+	Name string
+	// CompressionFormat is the format the decoder was listed for.
+	CompressionFormat CompressionFormat
+}
+
+// EncoderDescriptor describes an encoder that is available in libheif.
+type EncoderDescriptor struct {
+	// ID can be passed to Context.NewEncoderByID.
+	ID                string
+	Name              string
+	CompressionFormat CompressionFormat
+	SupportsLossy     bool
+	SupportsLossless  bool
+}
+
+func listDecoders(format CompressionFormat) []DecoderDescriptor {
+	num := int(C.heif_get_decoder_descriptors(uint32(format), nil, 0))
+	if num == 0 {
+		return nil
+	}
+
+	descriptors := make([]*C.struct_heif_decoder_descriptor, num)
+	num = int(C.heif_get_decoder_descriptors(uint32(format), &descriptors[0], C.int(num)))
+	result := make([]DecoderDescriptor, 0, num)
+	for _, d := range descriptors[:num] {
+		result = append(result, DecoderDescriptor{
+			ID:                C.GoString(C.heif_decoder_descriptor_get_id_name(d)),
+			Name:              C.GoString(C.heif_decoder_descriptor_get_name(d)),
+			CompressionFormat: format,
+		})
+	}
+	return result
+}
+
+// ListDecoders returns the decoders that are available for the given format,
+// sorted by priority. Pass CompressionUndefined to list the decoders of all
+// formats, a decoder supporting multiple formats is returned once per format.
+func ListDecoders(format CompressionFormat) []DecoderDescriptor {
+	if format != CompressionUndefined {
+		return listDecoders(format)
+	}
+
+	var result []DecoderDescriptor
+	for _, f := range compressionFormats {
+		result = append(result, listDecoders(f)...)
+	}
+	return result
+}
+
+func getEncoderDescriptors(format CompressionFormat) []*C.struct_heif_encoder_descriptor {
+	num := int(C.heif_get_encoder_descriptors(uint32(format), nil, nil, 0))
+	if num == 0 {
+		return nil
+	}
+
+	descriptors := make([]*C.struct_heif_encoder_descriptor, num)
+	num = int(C.heif_get_encoder_descriptors(uint32(format), nil, &descriptors[0], C.int(num)))
+	return descriptors[:num]
+}
+
+// ListEncoders returns the encoders that are available for the given format,
+// sorted by priority. Pass CompressionUndefined to list the encoders of all
+// formats. If onlyLossless is set, only encoders supporting lossless
+// compression are returned.
+func ListEncoders(format CompressionFormat, onlyLossless bool) []EncoderDescriptor {
+	var result []EncoderDescriptor
+	for _, d := range getEncoderDescriptors(format) {
+		descriptor := EncoderDescriptor{
+			ID:                C.GoString(C.heif_encoder_descriptor_get_id_name(d)),
+			Name:              C.GoString(C.heif_encoder_descriptor_get_name(d)),
+			CompressionFormat: CompressionFormat(C.heif_encoder_descriptor_get_compression_format(d)),
+			SupportsLossy:     C.heif_encoder_descriptor_supports_lossy_compression(d) != 0,
+			SupportsLossless:  C.heif_encoder_descriptor_supports_lossless_compression(d) != 0,
+		}
+		if onlyLossless && !descriptor.SupportsLossless {
+			continue
+		}
+
+		result = append(result, descriptor)
+	}
+	return result
+}
+
+// NewEncoderByID creates a new encoder with the given id as returned by
+// ListEncoders.
+func (c *Context) NewEncoderByID(id string) (*Encoder, error) {
+	return c.newEncoderByID(id, CompressionUndefined)
+}
+
+// newEncoderByID creates a new encoder with the given id that must support
+// the format unless it is CompressionUndefined.
+func (c *Context) newEncoderByID(id string, format CompressionFormat) (*Encoder, error) {
+	defer runtime.KeepAlive(c)
+
+	if c.context == nil {
+		return nil, ErrClosed
+	}
+
+	for _, d := range getEncoderDescriptors(CompressionUndefined) {
+		if C.GoString(C.heif_encoder_descriptor_get_id_name(d)) != id {
+			continue
+		}
+
+		if f := CompressionFormat(C.heif_encoder_descriptor_get_compression_format(d)); format != CompressionUndefined && f != format {
+			return nil, fmt.Errorf("encoder %q does not support compression %v", id, format)
+		}
+
+		return c.convertEncoderDescriptor(d)
+	}
+
+	return nil, fmt.Errorf("no encoder with id %q", id)
+}
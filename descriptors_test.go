@@ -0,0 +1,70 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListDecoders(t *testing.T) {
+	assert := assert.New(t)
+
+	decoders := ListDecoders(CompressionHEVC)
+	if assert.NotEmpty(decoders) {
+		for _, d := range decoders {
+			assert.NotEmpty(d.ID)
+			assert.NotEmpty(d.Name)
+			assert.Equal(CompressionHEVC, d.CompressionFormat)
+		}
+	}
+
+	all := ListDecoders(CompressionUndefined)
+	for _, d := range decoders {
+		assert.Contains(all, d)
+	}
+}
+
+func TestListEncoders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encoders := ListEncoders(CompressionHEVC, false)
+	require.NotEmpty(encoders)
+	for _, e := range encoders {
+		assert.Equal(CompressionHEVC, e.CompressionFormat)
+		assert.NotEmpty(e.ID)
+	}
+	for _, e := range ListEncoders(CompressionUndefined, true) {
+		assert.True(e.SupportsLossless)
+	}
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	enc, err := ctx.NewEncoderByID(encoders[0].ID)
+	require.NoError(err)
+	assert.Equal(encoders[0].ID, enc.ID())
+	assert.Equal(encoders[0].Name, enc.Name())
+
+	_, err = ctx.NewEncoderByID("unknown-encoder")
+	assert.Error(err)
+}
@@ -28,7 +28,7 @@ import "C"
 import (
 	"fmt"
 	"image"
-	"runtime"
+	"time"
 )
 
 func imageFromRGBA(i *image.RGBA) (*Image, error) {
@@ -341,8 +341,158 @@ func SetEncoderParameter(name string, value string) EncoderParameterSetter {
 	}
 }
 
+// EncodeOption configures how EncodeFromImageWithOptions or Transcode encode
+// images. Any EncoderParameterSetter can be used as EncodeOption.
+type EncodeOption interface {
+	applyEncodeOption(options *encodeOptions)
+}
+
+type encodeOptions struct {
+	setters              []EncoderParameterSetter
+	encoderID            string
+	orientation          Orientation
+	thumbnailSize        int
+	exif                 *Exif
+	xmp                  *XMP
+	stripGPS             bool
+	normalizeOrientation bool
+	dropAuxiliaryImages  bool
+}
+
+func (s EncoderParameterSetter) applyEncodeOption(options *encodeOptions) {
+	options.setters = append(options.setters, s)
+}
+
+type encodeOptionFunc func(options *encodeOptions)
+
+func (f encodeOptionFunc) applyEncodeOption(options *encodeOptions) {
+	f(options)
+}
+
+// WithExif returns an option that adds the EXIF metadata to the encoded image.
+func WithExif(e *Exif) EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.exif = e
+	})
+}
+
+// WithXMP returns an option that adds the XMP metadata to the encoded image.
+func WithXMP(x *XMP) EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.xmp = x
+	})
+}
+
+// UseEncoder returns an option that selects the encoder with the given id as
+// returned by ListEncoders instead of the default encoder for the format.
+func UseEncoder(id string) EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.encoderID = id
+	})
+}
+
+// WithImageOrientation returns an option that stores the orientation as
+// transformations of the image, e.g. to preserve the EXIF orientation of
+// the source image. The pixel data is not modified.
+func WithImageOrientation(orientation Orientation) EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.orientation = orientation
+	})
+}
+
+// WithThumbnail returns an option that adds a thumbnail fitting into a square
+// of bboxSize pixels. No thumbnail is added if the image is not larger.
+func WithThumbnail(bboxSize int) EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.thumbnailSize = bboxSize
+	})
+}
+
+// StripGPS returns an option that removes all location information from the
+// EXIF metadata added with WithExif.
+func StripGPS() EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.stripGPS = true
+	})
+}
+
+// NormalizeOrientation returns an option that resets the orientation in the
+// EXIF metadata added with WithExif to normal. Use this if the pixel data
+// has already been rotated.
+func NormalizeOrientation() EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.normalizeOrientation = true
+	})
+}
+
+// DropAuxiliaryImages returns an option that lets Transcode drop depth and
+// other auxiliary images instead of failing with ErrAuxiliaryImages.
+func DropAuxiliaryImages() EncodeOption {
+	return encodeOptionFunc(func(options *encodeOptions) {
+		options.dropAuxiliaryImages = true
+	})
+}
+
+func (o *encodeOptions) addMetadata(ctx *Context, handle *ImageHandle) error {
+	if o.exif != nil {
+		e := o.exif
+		if o.stripGPS || o.normalizeOrientation {
+			e = e.Clone()
+		}
+		if o.stripGPS {
+			e.RemoveGPS()
+		}
+		if o.normalizeOrientation {
+			if err := e.SetOrientation(1); err != nil {
+				return err
+			}
+		}
+		if err := ctx.AddExif(handle, e); err != nil {
+			return fmt.Errorf("failed to add EXIF metadata: %w", err)
+		}
+	}
+
+	if o.xmp != nil {
+		if err := ctx.AddXMP(handle, o.xmp); err != nil {
+			return fmt.Errorf("failed to add XMP metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // EncodeFromImage is a high-level function to encode a Go Image to a new Context.
 func EncodeFromImage(img image.Image, compression CompressionFormat, params ...EncoderParameterSetter) (*Context, *ImageHandle, error) {
+	opts := make([]EncodeOption, len(params))
+	for i, param := range params {
+		opts[i] = param
+	}
+	return EncodeFromImageWithOptions(img, compression, opts...)
+}
+
+// EncodeFromImageWithOptions encodes a Go Image to a new Context like
+// EncodeFromImage, but also accepts options to add metadata, thumbnails or
+// to select the encoder.
+func EncodeFromImageWithOptions(img image.Image, compression CompressionFormat, opts ...EncodeOption) (*Context, *ImageHandle, error) {
+	start := time.Now()
+	ctx, handle, err := encodeFromImage(img, compression, opts...)
+	observe(start, func() Event {
+		event := Event{
+			Operation:   OperationEncode,
+			Compression: compression,
+			Err:         err,
+		}
+		if img != nil {
+			size := img.Bounds().Size()
+			event.Width = size.X
+			event.Height = size.Y
+		}
+		return event
+	})
+	return ctx, handle, err
+}
+
+func encodeFromImage(img image.Image, compression CompressionFormat, params ...EncodeOption) (*Context, *ImageHandle, error) {
 	if err := checkLibraryVersion(); err != nil {
 		return nil, nil, err
 	}
@@ -390,18 +540,32 @@ func EncodeFromImage(img image.Image, compression CompressionFormat, params ...E
 		out = tmp
 	}
 
+	// The native image is only needed while encoding.
+	defer out.Close()
+
 	ctx, err := NewContext()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create HEIF context: %v", err)
 	}
 
-	enc, err := ctx.NewEncoder(compression)
+	var options encodeOptions
+	for _, param := range params {
+		param.applyEncodeOption(&options)
+	}
+
+	var enc *Encoder
+	if options.encoderID != "" {
+		enc, err = ctx.newEncoderByID(options.encoderID, compression)
+	} else {
+		enc, err = ctx.NewEncoder(compression)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create encoder: %v", err)
 	}
+	defer enc.Close()
 
-	for _, param := range params {
-		if err := param(enc); err != nil {
+	for _, setter := range options.setters {
+		if err := setter(enc); err != nil {
 			return nil, nil, fmt.Errorf("error setting parameter: %w", err)
 		}
 	}
@@ -410,18 +574,26 @@ func EncodeFromImage(img image.Image, compression CompressionFormat, params ...E
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get encoding options: %v", err)
 	}
+	defer encOpts.Close()
 
-	defer runtime.KeepAlive(ctx)
-	defer runtime.KeepAlive(out)
-	defer runtime.KeepAlive(enc)
-	defer runtime.KeepAlive(encOpts)
+	if options.orientation != 0 {
+		encOpts.SetImageOrientation(options.orientation)
+	}
 
-	var handle ImageHandle
-	err2 := C.heif_context_encode_image(ctx.context, out.image, enc.encoder, encOpts.options, &handle.handle)
-	if err := convertHeifError(err2); err != nil {
+	handle, err := ctx.EncodeImage(out, enc, encOpts)
+	if err != nil {
 		return nil, nil, fmt.Errorf("failed to encode image: %v", err)
 	}
 
-	runtime.SetFinalizer(&handle, freeHeifImageHandle)
-	return ctx, &handle, nil
+	if options.thumbnailSize > 0 {
+		if _, err := ctx.EncodeThumbnail(out, handle, enc, encOpts, options.thumbnailSize); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+		}
+	}
+
+	if err := options.addMetadata(ctx, handle); err != nil {
+		return nil, nil, err
+	}
+
+	return ctx, handle, nil
 }
@@ -27,6 +27,7 @@ import "C"
 
 import (
 	"errors"
+	"fmt"
 	"runtime"
 	"unsafe"
 )
@@ -37,18 +38,34 @@ const (
 	encoderParamStringSize = 1024
 )
 
-// Encoder contains a libheif encoder object.
+// Encoder contains a libheif encoder object. An encoder must not be used by
+// multiple goroutines at the same time, use a Pool to share encoders.
 type Encoder struct {
 	encoder *C.struct_heif_encoder
 	id      string
 	name    string
+	format  CompressionFormat
+	// defaults caches the default parameter values of the encoder.
+	defaults map[string]any
 }
 
 func freeHeifEncoder(enc *Encoder) {
+	if enc.encoder == nil {
+		return
+	}
+
 	C.heif_encoder_release(enc.encoder)
 	enc.encoder = nil
 }
 
+// Close releases the encoder immediately instead of waiting for the garbage
+// collector. It is safe to call Close multiple times, other methods fail with
+// ErrClosed or return zero values after the encoder has been closed.
+func (e *Encoder) Close() {
+	runtime.SetFinalizer(e, nil)
+	freeHeifEncoder(e)
+}
+
 // ID returns the id of the encoder.
 func (e *Encoder) ID() string {
 	return e.id
@@ -63,6 +80,10 @@ func (e *Encoder) Name() string {
 func (e *Encoder) SetQuality(q int) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_lossy_quality(e.encoder, C.int(q))
 	return convertHeifError(err)
 }
@@ -71,6 +92,10 @@ func (e *Encoder) SetQuality(q int) error {
 func (e *Encoder) SetLossless(l LosslessMode) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_lossless(e.encoder, C.int(l))
 	return convertHeifError(err)
 }
@@ -79,6 +104,10 @@ func (e *Encoder) SetLossless(l LosslessMode) error {
 func (e *Encoder) SetLoggingLevel(l LoggingLevel) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_logging_level(e.encoder, C.int(l))
 	return convertHeifError(err)
 }
@@ -87,6 +116,10 @@ func (e *Encoder) SetLoggingLevel(l LoggingLevel) error {
 func (e *Encoder) ListParameters() []EncoderParameter {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return nil
+	}
+
 	parameters := C.heif_encoder_list_parameters(e.encoder)
 	if parameters == nil {
 		return nil
@@ -94,7 +127,7 @@ func (e *Encoder) ListParameters() []EncoderParameter {
 
 	var result []EncoderParameter
 	for *parameters != nil {
-		result = append(result, newEncoderParameter(*parameters))
+		result = append(result, newEncoderParameter(e, *parameters))
 		parameters = nextPointer(parameters)
 	}
 	return result
@@ -112,6 +145,10 @@ func (e *Encoder) ListParameters() []EncoderParameter {
 func (e *Encoder) SetParameter(name string, value string) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_parameter(e.encoder, C.CString(name), C.CString(value))
 	return convertHeifError(err)
 }
@@ -122,6 +159,10 @@ func (e *Encoder) SetParameter(name string, value string) error {
 func (e *Encoder) GetParameter(name string) (string, error) {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return "", ErrClosed
+	}
+
 	value := (*C.char)(C.malloc(encoderParamStringSize))
 	if value == nil {
 		return "", errors.New("can't allocate memory for value")
@@ -140,13 +181,70 @@ func (e *Encoder) GetParameter(name string) (string, error) {
 func (e *Encoder) HasDefault(name string) bool {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return false
+	}
+
 	return C.heif_encoder_has_default(e.encoder, C.CString(name)) != 0
 }
 
+// defaultParameters returns the default values of all parameters that have
+// one. The values are read once from a newly created encoder, as the current
+// values of the encoder might have been changed.
+func (e *Encoder) defaultParameters() (map[string]any, error) {
+	if e.defaults != nil {
+		return e.defaults, nil
+	}
+
+	ctx, err := NewContext()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Close()
+
+	fresh, err := ctx.newEncoderByID(e.id, CompressionUndefined)
+	if err != nil {
+		return nil, err
+	}
+	defer fresh.Close()
+
+	defaults := make(map[string]any)
+	for _, p := range fresh.ListParameters() {
+		name := p.Name()
+		if !fresh.HasDefault(name) {
+			continue
+		}
+
+		var value any
+		switch p.Type() {
+		case EncoderParameterTypeInteger:
+			value, err = fresh.GetParameterInteger(name)
+		case EncoderParameterTypeBoolean:
+			value, err = fresh.GetParameterBool(name)
+		case EncoderParameterTypeString:
+			value, err = fresh.GetParameterString(name)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default of parameter %q: %w", name, err)
+		}
+
+		defaults[name] = value
+	}
+
+	e.defaults = defaults
+	return defaults, nil
+}
+
 // SetParameterInteger sets the integer parameter.
 func (e *Encoder) SetParameterInteger(name string, value int) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_parameter_integer(e.encoder, C.CString(name), C.int(value))
 	return convertHeifError(err)
 }
@@ -155,6 +253,10 @@ func (e *Encoder) SetParameterInteger(name string, value int) error {
 func (e *Encoder) GetParameterInteger(name string) (int, error) {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return 0, ErrClosed
+	}
+
 	var value C.int
 	err := C.heif_encoder_get_parameter_integer(e.encoder, C.CString(name), &value)
 	if err := convertHeifError(err); err != nil {
@@ -168,6 +270,10 @@ func (e *Encoder) GetParameterInteger(name string) (int, error) {
 func (e *Encoder) SetParameterBool(name string, value bool) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_parameter_boolean(e.encoder, C.CString(name), convertBool[C.int](value))
 	return convertHeifError(err)
 }
@@ -176,6 +282,10 @@ func (e *Encoder) SetParameterBool(name string, value bool) error {
 func (e *Encoder) GetParameterBool(name string) (bool, error) {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return false, ErrClosed
+	}
+
 	var value C.int
 	err := C.heif_encoder_get_parameter_boolean(e.encoder, C.CString(name), &value)
 	if err := convertHeifError(err); err != nil {
@@ -189,6 +299,10 @@ func (e *Encoder) GetParameterBool(name string) (bool, error) {
 func (e *Encoder) SetParameterString(name string, value string) error {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
 	err := C.heif_encoder_set_parameter_string(e.encoder, C.CString(name), C.CString(value))
 	return convertHeifError(err)
 }
@@ -197,6 +311,10 @@ func (e *Encoder) SetParameterString(name string, value string) error {
 func (e *Encoder) GetParameterString(name string) (string, error) {
 	defer runtime.KeepAlive(e)
 
+	if e.encoder == nil {
+		return "", ErrClosed
+	}
+
 	value := (*C.char)(C.malloc(encoderParamStringSize))
 	if value == nil {
 		return "", errors.New("can't allocate memory for value")
@@ -33,12 +33,14 @@ import (
 
 // EncoderParameter defines a parameter that can be set on an encoder.
 type EncoderParameter struct {
-	param *C.struct_heif_encoder_parameter
+	param   *C.struct_heif_encoder_parameter
+	encoder *Encoder
 }
 
-func newEncoderParameter(p *C.struct_heif_encoder_parameter) EncoderParameter {
+func newEncoderParameter(encoder *Encoder, p *C.struct_heif_encoder_parameter) EncoderParameter {
 	return EncoderParameter{
-		param: p,
+		param:   p,
+		encoder: encoder,
 	}
 }
 
@@ -148,3 +150,19 @@ func (p EncoderParameter) StringValues() ([]string, error) {
 
 	return values, nil
 }
+
+// DefaultValue returns the default value of the parameter. The type of the
+// value is int, bool or string, depending on the parameter type.
+func (p EncoderParameter) DefaultValue() (any, bool) {
+	if p.encoder == nil {
+		return nil, false
+	}
+
+	defaults, err := p.encoder.defaultParameters()
+	if err != nil {
+		return nil, false
+	}
+
+	value, found := defaults[p.Name()]
+	return value, found
+}
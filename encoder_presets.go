@@ -0,0 +1,193 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"fmt"
+	"slices"
+)
+
+// IDs of encoders that have typed parameter setters.
+const (
+	EncoderIDX265   = "x265"
+	EncoderIDAom    = "aom"
+	EncoderIDSvtAV1 = "svt"
+	EncoderIDRav1e  = "rav1e"
+)
+
+func findEncoderParameter(e *Encoder, encoderID string, name string) (EncoderParameter, error) {
+	if e.ID() != encoderID {
+		return EncoderParameter{}, fmt.Errorf("parameter %q requires encoder %s, got %s", name, encoderID, e.ID())
+	}
+
+	for _, p := range e.ListParameters() {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+
+	return EncoderParameter{}, fmt.Errorf("encoder %s does not support parameter %q", e.ID(), name)
+}
+
+// validateInteger checks the value against the range advertised for the
+// integer parameter.
+func validateInteger(p EncoderParameter, value int) error {
+	name := p.Name()
+	if t := p.Type(); t != EncoderParameterTypeInteger {
+		return fmt.Errorf("parameter %q is not an integer", name)
+	}
+
+	min, max, values, err := p.IntegerValues()
+	if err != nil {
+		return err
+	}
+
+	if min != nil && value < *min {
+		return fmt.Errorf("value %d of parameter %q is below minimum %d", value, name, *min)
+	}
+	if max != nil && value > *max {
+		return fmt.Errorf("value %d of parameter %q is above maximum %d", value, name, *max)
+	}
+	if len(values) > 0 && !slices.Contains(values, value) {
+		return fmt.Errorf("value %d of parameter %q is not one of %v", value, name, values)
+	}
+
+	return nil
+}
+
+// validateString checks the value against the values advertised for the
+// string parameter.
+func validateString(p EncoderParameter, value string) error {
+	name := p.Name()
+	if t := p.Type(); t != EncoderParameterTypeString {
+		return fmt.Errorf("parameter %q is not a string", name)
+	}
+
+	values, err := p.StringValues()
+	if err != nil {
+		return err
+	}
+
+	if len(values) > 0 && !slices.Contains(values, value) {
+		return fmt.Errorf("value %q of parameter %q is not one of %q", value, name, values)
+	}
+
+	return nil
+}
+
+func setIntegerParameter(encoderID string, name string, value int) EncoderParameterSetter {
+	return func(e *Encoder) error {
+		p, err := findEncoderParameter(e, encoderID, name)
+		if err != nil {
+			return err
+		}
+
+		if err := validateInteger(p, value); err != nil {
+			return err
+		}
+
+		return e.SetParameterInteger(name, value)
+	}
+}
+
+func setStringParameter(encoderID string, name string, value string) EncoderParameterSetter {
+	return func(e *Encoder) error {
+		p, err := findEncoderParameter(e, encoderID, name)
+		if err != nil {
+			return err
+		}
+
+		if err := validateString(p, value); err != nil {
+			return err
+		}
+
+		return e.SetParameterString(name, value)
+	}
+}
+
+// SetX265Preset sets the x265 speed preset, e.g. "medium" or "slower".
+func SetX265Preset(preset string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDX265, "preset", preset)
+}
+
+// SetX265Tune sets the x265 tuning, e.g. "ssim" or "grain".
+func SetX265Tune(tune string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDX265, "tune", tune)
+}
+
+// SetX265TUIntraDepth sets the maximum transform unit recursion depth of x265.
+func SetX265TUIntraDepth(depth int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDX265, "tu-intra-depth", depth)
+}
+
+// SetX265Complexity sets the encoding complexity of x265 in percent.
+func SetX265Complexity(complexity int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDX265, "complexity", complexity)
+}
+
+// SetAomSpeed sets the speed of the aom encoder, higher values are faster.
+func SetAomSpeed(speed int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDAom, "speed", speed)
+}
+
+// SetAomThreads sets the number of threads the aom encoder uses.
+func SetAomThreads(threads int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDAom, "threads", threads)
+}
+
+// SetAomChroma sets the chroma subsampling of the aom encoder, e.g. "420".
+func SetAomChroma(chroma string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDAom, "chroma", chroma)
+}
+
+// SetAomTune sets the aom tuning, e.g. "psnr" or "ssim".
+func SetAomTune(tune string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDAom, "tune", tune)
+}
+
+// SetSvtAV1Speed sets the speed of the SVT-AV1 encoder, higher values are faster.
+func SetSvtAV1Speed(speed int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDSvtAV1, "speed", speed)
+}
+
+// SetSvtAV1Threads sets the number of threads the SVT-AV1 encoder uses.
+func SetSvtAV1Threads(threads int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDSvtAV1, "threads", threads)
+}
+
+// SetSvtAV1Chroma sets the chroma subsampling of the SVT-AV1 encoder.
+func SetSvtAV1Chroma(chroma string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDSvtAV1, "chroma", chroma)
+}
+
+// SetRav1eSpeed sets the speed of the rav1e encoder, higher values are faster.
+func SetRav1eSpeed(speed int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDRav1e, "speed", speed)
+}
+
+// SetRav1eThreads sets the number of threads the rav1e encoder uses.
+func SetRav1eThreads(threads int) EncoderParameterSetter {
+	return setIntegerParameter(EncoderIDRav1e, "threads", threads)
+}
+
+// SetRav1eChroma sets the chroma subsampling of the rav1e encoder, e.g. "420".
+func SetRav1eChroma(chroma string) EncoderParameterSetter {
+	return setStringParameter(EncoderIDRav1e, "chroma", chroma)
+}
@@ -0,0 +1,55 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderPresets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	enc, err := ctx.NewEncoderByID(EncoderIDX265)
+	if err != nil {
+		t.Skipf("x265 encoder not available: %s", err)
+	}
+
+	assert.NoError(SetX265Preset("slower")(enc))
+	if value, err := enc.GetParameterString("preset"); assert.NoError(err) {
+		assert.Equal("slower", value)
+	}
+	assert.NoError(SetX265Tune("ssim")(enc))
+	assert.NoError(SetX265TUIntraDepth(2)(enc))
+	if value, err := enc.GetParameterInteger("tu-intra-depth"); assert.NoError(err) {
+		assert.Equal(2, value)
+	}
+	assert.NoError(SetX265Complexity(50)(enc))
+
+	assert.ErrorContains(SetX265Preset("invalid")(enc), "not one of")
+	assert.ErrorContains(SetX265TUIntraDepth(0)(enc), "below minimum")
+	assert.ErrorContains(SetX265Complexity(101)(enc), "above maximum")
+	assert.ErrorContains(SetAomSpeed(5)(enc), "requires encoder aom")
+}
@@ -0,0 +1,224 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Types of encoder parameters in the JSON schema.
+const (
+	ParameterSchemaTypeInteger = "integer"
+	ParameterSchemaTypeBoolean = "boolean"
+	ParameterSchemaTypeString  = "string"
+)
+
+// EncoderParameterSchema describes a single encoder parameter.
+type EncoderParameterSchema struct {
+	Name string `json:"name"`
+	// Type is one of "integer", "boolean" or "string".
+	Type    string `json:"type"`
+	Minimum *int   `json:"minimum,omitempty"`
+	Maximum *int   `json:"maximum,omitempty"`
+	// Values are the allowed values of integer parameters.
+	Values []int `json:"values,omitempty"`
+	// Allowed are the allowed values of string parameters.
+	Allowed    []string `json:"allowed,omitempty"`
+	HasDefault bool     `json:"has_default"`
+	Default    any      `json:"default,omitempty"`
+}
+
+// EncoderSchema describes the parameters of an encoder.
+type EncoderSchema struct {
+	ID         string                   `json:"id"`
+	Name       string                   `json:"name"`
+	Parameters []EncoderParameterSchema `json:"parameters"`
+}
+
+func newEncoderParameterSchema(p EncoderParameter) (EncoderParameterSchema, error) {
+	result := EncoderParameterSchema{
+		Name: p.Name(),
+	}
+	switch p.Type() {
+	case EncoderParameterTypeInteger:
+		result.Type = ParameterSchemaTypeInteger
+		min, max, values, err := p.IntegerValues()
+		if err != nil {
+			return result, err
+		}
+
+		result.Minimum = min
+		result.Maximum = max
+		result.Values = values
+	case EncoderParameterTypeBoolean:
+		result.Type = ParameterSchemaTypeBoolean
+	case EncoderParameterTypeString:
+		result.Type = ParameterSchemaTypeString
+		values, err := p.StringValues()
+		if err != nil {
+			return result, err
+		}
+
+		result.Allowed = values
+	default:
+		return result, fmt.Errorf("unsupported type %d of parameter %q", p.Type(), result.Name)
+	}
+
+	result.Default, result.HasDefault = p.DefaultValue()
+	return result, nil
+}
+
+// ParameterSchema returns a JSON serializable description of the parameters
+// the encoder supports.
+func (e *Encoder) ParameterSchema() (*EncoderSchema, error) {
+	if e.encoder == nil {
+		return nil, ErrClosed
+	}
+
+	result := &EncoderSchema{
+		ID:         e.ID(),
+		Name:       e.Name(),
+		Parameters: []EncoderParameterSchema{},
+	}
+	for _, p := range e.ListParameters() {
+		schema, err := newEncoderParameterSchema(p)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Parameters = append(result.Parameters, schema)
+	}
+	return result, nil
+}
+
+// presetParameters change the values of other parameters, so they are
+// applied first. Otherwise e.g. an explicit "tu-intra-depth" would be
+// overwritten by the "preset" of x265.
+var presetParameters = []string{"preset", "tune"}
+
+// sortParameterNames sorts the names in the order the parameters must be
+// applied: presets first, then all other parameters by name.
+func sortParameterNames(names []string) {
+	rank := func(name string) int {
+		if idx := slices.Index(presetParameters, name); idx >= 0 {
+			return idx
+		}
+		return len(presetParameters)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// ApplyJSON sets the encoder parameters from a JSON object mapping parameter
+// names to values, e.g. {"preset": "slower", "tu-intra-depth": 2}. Values
+// are validated against the parameter schema of the encoder before any
+// parameter is set. Presets are set before all other parameters, so they
+// don't overwrite explicitly passed values.
+func (e *Encoder) ApplyJSON(data []byte) error {
+	if e.encoder == nil {
+		return ErrClosed
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("invalid encoder parameters: %w", err)
+	}
+	if values == nil {
+		return errors.New("encoder parameters must be a JSON object")
+	}
+
+	parameters := make(map[string]EncoderParameter)
+	for _, p := range e.ListParameters() {
+		parameters[p.Name()] = p
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sortParameterNames(names)
+
+	setters := make([]EncoderParameterSetter, 0, len(values))
+	for _, name := range names {
+		value := values[name]
+		p, found := parameters[name]
+		if !found {
+			return fmt.Errorf("encoder %s does not support parameter %q", e.ID(), name)
+		}
+
+		switch t := p.Type(); t {
+		case EncoderParameterTypeInteger:
+			n, ok := value.(json.Number)
+			if !ok {
+				return fmt.Errorf("parameter %q must be an integer", name)
+			}
+
+			i, err := n.Int64()
+			if err != nil {
+				return fmt.Errorf("parameter %q must be an integer", name)
+			}
+
+			if err := validateInteger(p, int(i)); err != nil {
+				return err
+			}
+
+			setters = append(setters, SetEncoderParameterInteger(name, int(i)))
+		case EncoderParameterTypeBoolean:
+			b, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("parameter %q must be a boolean", name)
+			}
+
+			setters = append(setters, SetEncoderParameterBool(name, b))
+		case EncoderParameterTypeString:
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("parameter %q must be a string", name)
+			}
+
+			if err := validateString(p, s); err != nil {
+				return err
+			}
+
+			setters = append(setters, SetEncoderParameterString(name, s))
+		default:
+			return fmt.Errorf("unsupported type %d of parameter %q", t, name)
+		}
+	}
+
+	for _, setter := range setters {
+		if err := setter(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
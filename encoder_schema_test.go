@@ -0,0 +1,131 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderParameterSchema(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	enc, err := ctx.NewEncoder(CompressionHEVC)
+	require.NoError(err)
+
+	schema, err := enc.ParameterSchema()
+	require.NoError(err)
+	assert.Equal(enc.ID(), schema.ID)
+	require.Len(schema.Parameters, len(enc.ListParameters()))
+
+	data, err := json.Marshal(schema)
+	require.NoError(err)
+	var decoded EncoderSchema
+	require.NoError(json.Unmarshal(data, &decoded))
+	assert.Equal(schema.ID, decoded.ID)
+	assert.Len(decoded.Parameters, len(schema.Parameters))
+
+	for _, p := range schema.Parameters {
+		assert.Contains([]string{
+			ParameterSchemaTypeInteger,
+			ParameterSchemaTypeBoolean,
+			ParameterSchemaTypeString,
+		}, p.Type)
+		if p.HasDefault {
+			assert.NotNil(p.Default, p.Name)
+		}
+
+		switch {
+		case p.Type == ParameterSchemaTypeInteger && p.Maximum != nil:
+			assert.NoError(enc.ApplyJSON([]byte(fmt.Sprintf(`{%q: %d}`, p.Name, *p.Maximum))))
+			if value, err := enc.GetParameterInteger(p.Name); assert.NoError(err) {
+				assert.Equal(*p.Maximum, value)
+			}
+			assert.Error(enc.ApplyJSON([]byte(fmt.Sprintf(`{%q: %d}`, p.Name, *p.Maximum+1))))
+			assert.Error(enc.ApplyJSON([]byte(fmt.Sprintf(`{%q: "1"}`, p.Name))))
+		case p.Type == ParameterSchemaTypeString && len(p.Allowed) > 0:
+			assert.NoError(enc.ApplyJSON([]byte(fmt.Sprintf(`{%q: %q}`, p.Name, p.Allowed[0]))))
+			assert.Error(enc.ApplyJSON([]byte(fmt.Sprintf(`{%q: "invalid-value"}`, p.Name))))
+		}
+	}
+
+	assert.Error(enc.ApplyJSON([]byte(`{"unknown-parameter": 1}`)))
+	assert.Error(enc.ApplyJSON([]byte(`[]`)))
+	assert.Error(enc.ApplyJSON([]byte(`null`)))
+	assert.NoError(enc.ApplyJSON([]byte(`{}`)))
+}
+
+func TestEncoderParameterDefaultValue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	defer ctx.Close()
+	enc, err := ctx.NewEncoder(CompressionHEVC)
+	require.NoError(err)
+	defer enc.Close()
+
+	// A new encoder uses the default values.
+	defaults := make(map[string]any)
+	for _, p := range enc.ListParameters() {
+		value, found := p.DefaultValue()
+		assert.Equal(enc.HasDefault(p.Name()), found, p.Name())
+		if !found {
+			continue
+		}
+
+		var current any
+		switch p.Type() {
+		case EncoderParameterTypeInteger:
+			current, err = enc.GetParameterInteger(p.Name())
+		case EncoderParameterTypeBoolean:
+			current, err = enc.GetParameterBool(p.Name())
+		case EncoderParameterTypeString:
+			current, err = enc.GetParameterString(p.Name())
+		}
+		if assert.NoError(err, p.Name()) {
+			assert.Equal(current, value, p.Name())
+		}
+		defaults[p.Name()] = value
+	}
+
+	// Changing the encoder doesn't change the defaults.
+	require.NoError(enc.SetQuality(1))
+	for _, p := range enc.ListParameters() {
+		value, found := p.DefaultValue()
+		if expected, ok := defaults[p.Name()]; assert.Equal(ok, found, p.Name()) && found {
+			assert.Equal(expected, value, p.Name())
+		}
+	}
+}
+
+func TestSortParameterNames(t *testing.T) {
+	names := []string{"tu-intra-depth", "tune", "complexity", "preset"}
+	sortParameterNames(names)
+	assert.Equal(t, []string{"preset", "tune", "complexity", "tu-intra-depth"}, names)
+}
@@ -83,3 +83,91 @@ func TestEncoder(t *testing.T) {
 	}
 
 }
+
+func TestEncodeExif(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	e := NewExif()
+	e.SetMake("Example")
+	require.NoError(e.SetOrientation(6))
+	e.gps = &exifIFD{}
+	e.gps.set(newExifString(exifTagGPSLatitudeRef, "N"))
+	e.refresh()
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	ctx, handle, err := EncodeFromImageWithOptions(img, CompressionHEVC,
+		SetEncoderQuality(50),
+		WithExif(e),
+		StripGPS(),
+		NormalizeOrientation(),
+	)
+	require.NoError(err)
+
+	ids := handle.GetMetadataBlockIDs("Exif")
+	require.Len(ids, 1)
+	if data, err := handle.GetMetadata(ids[0]); assert.NoError(err) {
+		// Offset to the TIFF header.
+		assert.Equal([]byte{0, 0, 0, 0}, data[:4])
+	}
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+
+	ctx2, err := NewContext()
+	require.NoError(err)
+	require.NoError(ctx2.ReadFromMemory(out.Bytes()))
+	handle2, err := ctx2.GetPrimaryImageHandle()
+	require.NoError(err)
+
+	exif, err := handle2.GetExif()
+	require.NoError(err)
+	require.NotNil(exif)
+	assert.Equal("Example", exif.Make)
+	assert.Equal(1, exif.Orientation)
+	assert.Nil(exif.gps)
+
+	assert.Error(ctx.AddExif(handle, &Exif{}))
+
+	// The passed EXIF data is not modified.
+	assert.Equal(6, e.Orientation)
+	assert.NotNil(e.gps)
+}
+
+func TestEncodeOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encoders := ListEncoders(CompressionHEVC, false)
+	require.NotEmpty(encoders)
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	ctx, _, err := EncodeFromImageWithOptions(img, CompressionHEVC,
+		SetEncoderQuality(50),
+		UseEncoder(encoders[0].ID),
+		WithImageOrientation(OrientationRotate90Cw),
+		WithThumbnail(64),
+	)
+	require.NoError(err)
+
+	handle := reloadPrimaryImage(t, ctx)
+	assert.Equal(1, handle.GetNumberOfThumbnails())
+	if haveTransformationProperties {
+		if transformations, err := handle.GetTransformations(); assert.NoError(err) {
+			assert.NotEmpty(transformations)
+		}
+	}
+	size := img.Bounds().Size()
+	assert.Equal(size.Y, handle.GetWidth())
+	assert.Equal(size.X, handle.GetHeight())
+
+	_, _, err = EncodeFromImageWithOptions(img, CompressionAV1, UseEncoder(encoders[0].ID))
+	assert.Error(err)
+
+	// Encoder parameters can still be passed as a slice.
+	params := []EncoderParameterSetter{
+		SetEncoderQuality(50),
+	}
+	_, _, err = EncodeFromImage(img, CompressionHEVC, params...)
+	assert.NoError(err)
+}
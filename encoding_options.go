@@ -36,10 +36,22 @@ type EncodingOptions struct {
 }
 
 func freeHeifEncodingOptions(options *EncodingOptions) {
+	if options.options == nil {
+		return
+	}
+
 	C.heif_encoding_options_free(options.options)
 	options.options = nil
 }
 
+// Close releases the options immediately instead of waiting for the garbage
+// collector. It is safe to call Close multiple times. Closed options can no
+// longer be modified and make encoding fail with ErrClosed.
+func (o *EncodingOptions) Close() {
+	runtime.SetFinalizer(o, nil)
+	freeHeifEncodingOptions(o)
+}
+
 func NewEncodingOptions() (*EncodingOptions, error) {
 	if err := checkLibraryVersion(); err != nil {
 		return nil, err
@@ -57,3 +69,23 @@ func NewEncodingOptions() (*EncodingOptions, error) {
 	options.options.color_conversion_options.version = 1
 	return options, nil
 }
+
+// SetImageOrientation sets the orientation of the encoded image. Instead of
+// modifying the pixel data, the orientation is stored as transformations in
+// the file which are applied when decoding.
+func (o *EncodingOptions) SetImageOrientation(orientation Orientation) {
+	if o.options == nil {
+		return
+	}
+
+	o.options.image_orientation = uint32(orientation)
+}
+
+// GetImageOrientation returns the orientation of the encoded image.
+func (o *EncodingOptions) GetImageOrientation() Orientation {
+	if o.options == nil {
+		return OrientationNormal
+	}
+
+	return Orientation(o.options.image_orientation)
+}
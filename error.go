@@ -25,6 +25,13 @@ package libheif
 // #include <libheif/heif.h>
 import "C"
 
+import (
+	"errors"
+)
+
+// ErrClosed is returned when an object is used after it has been closed.
+var ErrClosed = errors.New("object has been closed")
+
 // HeifError contains information about an error in libheif.
 type HeifError struct {
 	Code    ErrorCode
@@ -0,0 +1,147 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif_test
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/strukturag/libheif-go"
+)
+
+// latencyBuckets are the upper bounds of the histogram buckets.
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+type metricsKey struct {
+	operation   libheif.Operation
+	compression libheif.CompressionFormat
+	code        libheif.ErrorCode
+}
+
+// histogram counts observations per bucket, the last bucket is +Inf.
+type histogram struct {
+	buckets []uint64
+	sum     time.Duration
+	bytes   int64
+}
+
+// metricsObserver is an Observer that records latency histograms labeled by
+// operation, compression format and error code, similar to a Prometheus
+// HistogramVec. A real adapter would forward the events to the metrics
+// library instead.
+type metricsObserver struct {
+	mu         sync.Mutex
+	histograms map[metricsKey]*histogram
+}
+
+func newMetricsObserver() *metricsObserver {
+	return &metricsObserver{
+		histograms: make(map[metricsKey]*histogram),
+	}
+}
+
+func (o *metricsObserver) Observe(event libheif.Event) {
+	key := metricsKey{
+		operation:   event.Operation,
+		compression: event.Compression,
+		code:        event.Code,
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	h, found := o.histograms[key]
+	if !found {
+		h = &histogram{
+			buckets: make([]uint64, len(latencyBuckets)+1),
+		}
+		o.histograms[key] = h
+	}
+
+	idx := sort.Search(len(latencyBuckets), func(i int) bool {
+		return event.Duration <= latencyBuckets[i]
+	})
+	h.buckets[idx]++
+	h.sum += event.Duration
+	h.bytes += event.Bytes
+}
+
+// Print writes the number of observations per label set. The latencies are
+// omitted as they differ between runs.
+func (o *metricsObserver) Print() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	keys := make([]metricsKey, 0, len(o.histograms))
+	for key := range o.histograms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.compression != b.compression {
+			return a.compression < b.compression
+		}
+		return a.code < b.code
+	})
+
+	for _, key := range keys {
+		var count uint64
+		for _, c := range o.histograms[key].buckets {
+			count += c
+		}
+		fmt.Printf("heif_%s_seconds_count{compression=%q,code=\"%d\"} %d\n",
+			key.operation, key.compression, key.code, count)
+	}
+}
+
+func Example_observer() {
+	observer := newMetricsObserver()
+	libheif.SetObserver(observer)
+	defer libheif.SetObserver(nil)
+
+	for i := 0; i < 2; i++ {
+		fp, err := os.Open("testdata/example.heic")
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = libheif.Decode(fp, nil)
+		fp.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	observer.Print()
+	// Output:
+	// heif_read_seconds_count{compression="hevc",code="0"} 2
+	// heif_decode_seconds_count{compression="hevc",code="0"} 2
+}
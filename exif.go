@@ -0,0 +1,499 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TIFF field types used in EXIF data.
+const (
+	exifTypeByte      = 1
+	exifTypeASCII     = 2
+	exifTypeShort     = 3
+	exifTypeLong      = 4
+	exifTypeRational  = 5
+	exifTypeSByte     = 6
+	exifTypeUndefined = 7
+	exifTypeSShort    = 8
+	exifTypeSLong     = 9
+	exifTypeSRational = 10
+	exifTypeFloat     = 11
+	exifTypeDouble    = 12
+)
+
+// EXIF tags that are evaluated.
+const (
+	exifTagMake             = 0x010f
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagExposureTime     = 0x829a
+	exifTagFNumber          = 0x829d
+	exifTagISOSpeed         = 0x8827
+	exifTagDateTimeOriginal = 0x9003
+	exifTagOffsetTimeOrig   = 0x9011
+	exifTagFocalLength      = 0x920a
+	exifTagInteropIFD       = 0xa005
+	exifTagGPSLatitudeRef   = 0x0001
+	exifTagGPSLatitude      = 0x0002
+	exifTagGPSLongitudeRef  = 0x0003
+	exifTagGPSLongitude     = 0x0004
+	exifTagGPSAltitudeRef   = 0x0005
+	exifTagGPSAltitude      = 0x0006
+	exifTagThumbnailOffset  = 0x0201
+	exifTagThumbnailLength  = 0x0202
+)
+
+const (
+	exifDateTimeFormat       = "2006:01:02 15:04:05"
+	exifMaxEntriesPerIFD     = 1024
+	exifHeaderSize           = 8
+	exifEntrySize            = 12
+	exifMaxInlineValueLength = 4
+)
+
+var exifTypeSizes = map[uint16]int{
+	exifTypeByte:      1,
+	exifTypeASCII:     1,
+	exifTypeShort:     2,
+	exifTypeLong:      4,
+	exifTypeRational:  8,
+	exifTypeSByte:     1,
+	exifTypeUndefined: 1,
+	exifTypeSShort:    2,
+	exifTypeSLong:     4,
+	exifTypeSRational: 8,
+	exifTypeFloat:     4,
+	exifTypeDouble:    8,
+}
+
+// exifByteOrder is the byte order used for reading and writing EXIF data.
+type exifByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// exifEntry is a single field of an image file directory.
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	// value contains the raw bytes of the value in the byte order of the
+	// EXIF data. For unknown types, it contains the raw value or offset
+	// field of the entry.
+	value []byte
+}
+
+// exifIFD is an image file directory.
+type exifIFD struct {
+	entries []exifEntry
+}
+
+func (d *exifIFD) find(tag uint16) *exifEntry {
+	if d == nil {
+		return nil
+	}
+
+	for idx := range d.entries {
+		if d.entries[idx].tag == tag {
+			return &d.entries[idx]
+		}
+	}
+	return nil
+}
+
+// GPSInfo contains the location an image was taken at.
+type GPSInfo struct {
+	// Latitude in degrees, negative values are south of the equator.
+	Latitude float64
+	// Longitude in degrees, negative values are west of the prime meridian.
+	Longitude float64
+	// Altitude in meters, negative values are below sea level.
+	Altitude float64
+}
+
+// Exif contains information parsed from EXIF metadata.
+//
+// The exported fields are a read-only view of the metadata. They are updated
+// after parsing and by every setter, but changes to them are not written
+// back: use the setters like SetOrientation or SetMake to modify the data
+// returned by Bytes. The zero value is empty metadata that can be filled
+// using the setters.
+type Exif struct {
+	// Orientation of the image as defined by the EXIF specification, i.e.
+	// 1 (normal) to 8 or 0 if not present.
+	Orientation int
+	// DateTime is the time the image was taken (or created if that is not
+	// available). Times without an offset are returned as UTC.
+	DateTime time.Time
+	// Make is the manufacturer of the camera.
+	Make string
+	// Model is the model of the camera.
+	Model string
+	// GPS contains the location the image was taken at, nil if not present.
+	GPS *GPSInfo
+	// ExposureTime in seconds.
+	ExposureTime float64
+	// FNumber is the aperture of the camera.
+	FNumber float64
+	// ISOSpeed is the sensitivity of the camera.
+	ISOSpeed int
+	// FocalLength of the lens in millimeters.
+	FocalLength float64
+
+	// Raw contains the TIFF payload of the EXIF metadata, see Bytes.
+	Raw []byte
+
+	order     exifByteOrder
+	ifd0      *exifIFD
+	exif      *exifIFD
+	gps       *exifIFD
+	interop   *exifIFD
+	ifd1      *exifIFD
+	thumbnail []byte
+}
+
+type exifParser struct {
+	data  []byte
+	order exifByteOrder
+	seen  map[uint32]bool
+}
+
+func (p *exifParser) parseIFD(offset uint32) (*exifIFD, uint32, error) {
+	if p.seen[offset] {
+		return nil, 0, fmt.Errorf("loop in EXIF directories at offset %d", offset)
+	}
+	p.seen[offset] = true
+
+	if uint64(offset)+2 > uint64(len(p.data)) {
+		return nil, 0, fmt.Errorf("EXIF directory offset %d out of range", offset)
+	}
+
+	count := int(p.order.Uint16(p.data[offset:]))
+	if count > exifMaxEntriesPerIFD {
+		return nil, 0, fmt.Errorf("too many EXIF entries: %d", count)
+	}
+
+	pos := uint64(offset) + 2
+	if pos+uint64(count)*exifEntrySize+4 > uint64(len(p.data)) {
+		return nil, 0, errors.New("EXIF directory exceeds data")
+	}
+
+	ifd := &exifIFD{
+		entries: make([]exifEntry, 0, count),
+	}
+	for i := 0; i < count; i++ {
+		entry := p.data[pos : pos+exifEntrySize]
+		pos += exifEntrySize
+
+		e := exifEntry{
+			tag:   p.order.Uint16(entry[0:]),
+			typ:   p.order.Uint16(entry[2:]),
+			count: p.order.Uint32(entry[4:]),
+		}
+		size, found := exifTypeSizes[e.typ]
+		if !found {
+			// The size of values with unknown types is not known, keep the
+			// raw value field so the entry is written back unchanged.
+			e.value = bytes.Clone(entry[8:12])
+			ifd.entries = append(ifd.entries, e)
+			continue
+		}
+
+		length := uint64(size) * uint64(e.count)
+		if length <= exifMaxInlineValueLength {
+			e.value = bytes.Clone(entry[8 : 8+length])
+		} else {
+			start := uint64(p.order.Uint32(entry[8:]))
+			if start+length > uint64(len(p.data)) {
+				return nil, 0, fmt.Errorf("value of EXIF tag 0x%04x out of range", e.tag)
+			}
+
+			e.value = bytes.Clone(p.data[start : start+length])
+		}
+		ifd.entries = append(ifd.entries, e)
+	}
+
+	// Entries must be sorted by tag, but not all writers follow this.
+	slices.SortStableFunc(ifd.entries, func(a, b exifEntry) int {
+		return int(a.tag) - int(b.tag)
+	})
+
+	next := p.order.Uint32(p.data[pos:])
+	return ifd, next, nil
+}
+
+func (p *exifParser) parseSubIFD(parent *exifIFD, tag uint16) (*exifIFD, error) {
+	entry := parent.find(tag)
+	if entry == nil {
+		return nil, nil
+	}
+
+	offset, ok := entry.uint(p.order)
+	if !ok {
+		return nil, fmt.Errorf("invalid offset for EXIF tag 0x%04x", tag)
+	}
+
+	ifd, _, err := p.parseIFD(uint32(offset))
+	return ifd, err
+}
+
+// ParseExif parses EXIF metadata from the given TIFF payload, i.e. data
+// starting with the "II" or "MM" byte order marker.
+func ParseExif(data []byte) (*Exif, error) {
+	if len(data) < exifHeaderSize {
+		return nil, errors.New("EXIF data too short")
+	}
+
+	var order exifByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid EXIF byte order")
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, errors.New("invalid EXIF header")
+	}
+
+	p := &exifParser{
+		data:  data,
+		order: order,
+		seen:  make(map[uint32]bool),
+	}
+	ifd0, next, err := p.parseIFD(order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exif{
+		Raw:   data,
+		order: order,
+		ifd0:  ifd0,
+	}
+	if e.exif, err = p.parseSubIFD(ifd0, exifTagExifIFD); err != nil {
+		return nil, err
+	}
+	if e.gps, err = p.parseSubIFD(ifd0, exifTagGPSIFD); err != nil {
+		return nil, err
+	}
+	if e.interop, err = p.parseSubIFD(e.exif, exifTagInteropIFD); err != nil {
+		return nil, err
+	}
+	if next != 0 {
+		// The second directory describes the thumbnail image.
+		if e.ifd1, _, err = p.parseIFD(next); err != nil {
+			return nil, err
+		}
+
+		offset, ok1 := e.ifd1.find(exifTagThumbnailOffset).uint(order)
+		length, ok2 := e.ifd1.find(exifTagThumbnailLength).uint(order)
+		if ok1 && ok2 && offset+length <= uint64(len(data)) {
+			e.thumbnail = bytes.Clone(data[offset : offset+length])
+		}
+	}
+
+	e.update()
+	return e, nil
+}
+
+// update sets the public fields from the parsed directories.
+func (e *Exif) update() {
+	order := e.order
+	orientation, _ := e.ifd0.find(exifTagOrientation).uint(order)
+	e.Orientation = int(orientation)
+	e.Make = e.ifd0.find(exifTagMake).string()
+	e.Model = e.ifd0.find(exifTagModel).string()
+
+	e.DateTime = time.Time{}
+	dt := e.exif.find(exifTagDateTimeOriginal).string()
+	offset := e.exif.find(exifTagOffsetTimeOrig).string()
+	if dt == "" {
+		dt = e.ifd0.find(exifTagDateTime).string()
+		offset = ""
+	}
+	if dt != "" {
+		if offset != "" {
+			if t, err := time.Parse(exifDateTimeFormat+"-07:00", dt+offset); err == nil {
+				e.DateTime = t
+			}
+		}
+		if e.DateTime.IsZero() {
+			if t, err := time.Parse(exifDateTimeFormat, dt); err == nil {
+				e.DateTime = t
+			}
+		}
+	}
+
+	e.ExposureTime, _ = e.exif.find(exifTagExposureTime).float(order, 0)
+	e.FNumber, _ = e.exif.find(exifTagFNumber).float(order, 0)
+	iso, _ := e.exif.find(exifTagISOSpeed).uint(order)
+	e.ISOSpeed = int(iso)
+	e.FocalLength, _ = e.exif.find(exifTagFocalLength).float(order, 0)
+
+	e.GPS = nil
+	latitude, ok1 := e.gps.find(exifTagGPSLatitude).degrees(order)
+	longitude, ok2 := e.gps.find(exifTagGPSLongitude).degrees(order)
+	if ok1 && ok2 {
+		gps := &GPSInfo{
+			Latitude:  latitude,
+			Longitude: longitude,
+		}
+		if strings.EqualFold(e.gps.find(exifTagGPSLatitudeRef).string(), "S") {
+			gps.Latitude = -gps.Latitude
+		}
+		if strings.EqualFold(e.gps.find(exifTagGPSLongitudeRef).string(), "W") {
+			gps.Longitude = -gps.Longitude
+		}
+		if altitude, ok := e.gps.find(exifTagGPSAltitude).float(order, 0); ok {
+			gps.Altitude = altitude
+			if ref, _ := e.gps.find(exifTagGPSAltitudeRef).uint(order); ref == 1 {
+				gps.Altitude = -gps.Altitude
+			}
+		}
+		e.GPS = gps
+	}
+}
+
+// uint returns the first value of an unsigned integer entry.
+func (e *exifEntry) uint(order binary.ByteOrder) (uint64, bool) {
+	if e == nil || e.count == 0 {
+		return 0, false
+	}
+
+	switch e.typ {
+	case exifTypeByte, exifTypeUndefined:
+		return uint64(e.value[0]), true
+	case exifTypeShort:
+		return uint64(order.Uint16(e.value)), true
+	case exifTypeLong:
+		return uint64(order.Uint32(e.value)), true
+	default:
+		return 0, false
+	}
+}
+
+// string returns the value of an ASCII entry.
+func (e *exifEntry) string() string {
+	if e == nil || e.typ != exifTypeASCII {
+		return ""
+	}
+
+	value := e.value
+	if idx := bytes.IndexByte(value, 0); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// float returns the value at the given index of a rational entry.
+func (e *exifEntry) float(order binary.ByteOrder, idx int) (float64, bool) {
+	if e == nil || uint32(idx) >= e.count {
+		return 0, false
+	}
+
+	switch e.typ {
+	case exifTypeRational:
+		num := order.Uint32(e.value[idx*8:])
+		den := order.Uint32(e.value[idx*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	case exifTypeSRational:
+		num := int32(order.Uint32(e.value[idx*8:]))
+		den := int32(order.Uint32(e.value[idx*8+4:]))
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	default:
+		return 0, false
+	}
+}
+
+// degrees returns the value of a GPS coordinate entry stored as degrees,
+// minutes and seconds.
+func (e *exifEntry) degrees(order binary.ByteOrder) (float64, bool) {
+	if e == nil || e.count < 3 {
+		return 0, false
+	}
+
+	d, ok1 := e.float(order, 0)
+	m, ok2 := e.float(order, 1)
+	s, ok3 := e.float(order, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+
+	return d + m/60 + s/3600, true
+}
+
+// splitExifMetadata returns the TIFF payload of an EXIF metadata block as
+// stored in HEIF files, i.e. with the leading offset to the TIFF header
+// removed.
+func splitExifMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("EXIF metadata too short")
+	}
+
+	offset := uint64(binary.BigEndian.Uint32(data)) + 4
+	if offset > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid EXIF header offset %d", offset-4)
+	}
+
+	return data[offset:], nil
+}
+
+// GetExif returns the parsed EXIF metadata of the image or nil if the image
+// has no EXIF metadata.
+func (h *ImageHandle) GetExif() (*Exif, error) {
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	ids := h.GetMetadataBlockIDs("Exif")
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	data, err := h.GetMetadata(ids[0])
+	if err != nil {
+		return nil, err
+	}
+
+	tiff, err := splitExifMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseExif(tiff)
+}
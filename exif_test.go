@@ -0,0 +1,309 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type testExifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func testRationals(order testByteOrder, values ...uint32) []byte {
+	var result []byte
+	for _, v := range values {
+		result = order.AppendUint32(result, v)
+	}
+	return result
+}
+
+// buildTestExif creates a TIFF payload with the given main, EXIF and GPS
+// directories. Pointers to the sub directories are added automatically.
+func buildTestExif(order testByteOrder, ifd0, exif, gps []testExifEntry) []byte {
+	ifdSize := func(entries []testExifEntry) int {
+		return 2 + len(entries)*12 + 4
+	}
+
+	ifd0 = append(ifd0,
+		testExifEntry{exifTagExifIFD, exifTypeLong, 1, nil},
+		testExifEntry{exifTagGPSIFD, exifTypeLong, 1, nil},
+	)
+	ifd0Offset := exifHeaderSize
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exif)
+	dataOffset := gpsOffset + ifdSize(gps)
+
+	var data []byte
+	writeIFD := func(out []byte, entries []testExifEntry) []byte {
+		out = order.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, e.typ)
+			out = order.AppendUint32(out, e.count)
+			switch {
+			case e.tag == exifTagExifIFD:
+				out = order.AppendUint32(out, uint32(exifOffset))
+			case e.tag == exifTagGPSIFD:
+				out = order.AppendUint32(out, uint32(gpsOffset))
+			case len(e.value) <= 4:
+				value := make([]byte, 4)
+				copy(value, e.value)
+				out = append(out, value...)
+			default:
+				out = order.AppendUint32(out, uint32(dataOffset+len(data)))
+				data = append(data, e.value...)
+			}
+		}
+		return order.AppendUint32(out, 0)
+	}
+
+	var result []byte
+	if order.Uint16([]byte{1, 0}) == 1 {
+		result = append(result, 'I', 'I')
+	} else {
+		result = append(result, 'M', 'M')
+	}
+	result = order.AppendUint16(result, 42)
+	result = order.AppendUint32(result, uint32(ifd0Offset))
+	result = writeIFD(result, ifd0)
+	result = writeIFD(result, exif)
+	result = writeIFD(result, gps)
+	return append(result, data...)
+}
+
+func TestParseExif(t *testing.T) {
+	for _, order := range []testByteOrder{binary.LittleEndian, binary.BigEndian} {
+		order := order
+		t.Run(order.String(), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data := buildTestExif(order, []testExifEntry{
+				{exifTagMake, exifTypeASCII, 6, []byte("Apple\x00")},
+				{exifTagModel, exifTypeASCII, 10, []byte("iPhone 15\x00")},
+				{exifTagOrientation, exifTypeShort, 1, order.AppendUint16(nil, 6)},
+				{exifTagDateTime, exifTypeASCII, 20, []byte("2024:01:02 03:04:05\x00")},
+			}, []testExifEntry{
+				{exifTagExposureTime, exifTypeRational, 1, testRationals(order, 1, 125)},
+				{exifTagFNumber, exifTypeRational, 1, testRationals(order, 18, 10)},
+				{exifTagISOSpeed, exifTypeShort, 1, order.AppendUint16(nil, 200)},
+				{exifTagDateTimeOriginal, exifTypeASCII, 20, []byte("2024:05:06 07:08:09\x00")},
+				{exifTagOffsetTimeOrig, exifTypeASCII, 7, []byte("+02:00\x00")},
+				{exifTagFocalLength, exifTypeRational, 1, testRationals(order, 26, 1)},
+			}, []testExifEntry{
+				{exifTagGPSLatitudeRef, exifTypeASCII, 2, []byte("N\x00")},
+				{exifTagGPSLatitude, exifTypeRational, 3, testRationals(order, 52, 1, 30, 1, 0, 1)},
+				{exifTagGPSLongitudeRef, exifTypeASCII, 2, []byte("W\x00")},
+				{exifTagGPSLongitude, exifTypeRational, 3, testRationals(order, 13, 1, 15, 1, 36, 1)},
+				{exifTagGPSAltitudeRef, exifTypeByte, 1, []byte{1}},
+				{exifTagGPSAltitude, exifTypeRational, 1, testRationals(order, 150, 10)},
+			})
+
+			e, err := ParseExif(data)
+			require.NoError(err)
+			assert.Equal(data, e.Raw)
+			assert.Equal(6, e.Orientation)
+			assert.Equal("Apple", e.Make)
+			assert.Equal("iPhone 15", e.Model)
+			assert.True(time.Date(2024, 5, 6, 5, 8, 9, 0, time.UTC).Equal(e.DateTime), e.DateTime)
+			assert.InDelta(1.0/125, e.ExposureTime, 1e-9)
+			assert.InDelta(1.8, e.FNumber, 1e-9)
+			assert.Equal(200, e.ISOSpeed)
+			assert.InDelta(26, e.FocalLength, 1e-9)
+			if assert.NotNil(e.GPS) {
+				assert.InDelta(52.5, e.GPS.Latitude, 1e-9)
+				assert.InDelta(-13.26, e.GPS.Longitude, 1e-9)
+				assert.InDelta(-15, e.GPS.Altitude, 1e-9)
+			}
+		})
+	}
+}
+
+func TestParseExifInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseExif(nil)
+	assert.Error(err)
+	_, err = ParseExif([]byte("XX*\x00\x00\x00\x00\x08"))
+	assert.Error(err)
+
+	data := buildTestExif(binary.BigEndian, []testExifEntry{
+		{exifTagMake, exifTypeASCII, 6, []byte("Apple\x00")},
+	}, nil, nil)
+	_, err = ParseExif(data[:len(data)-3])
+	assert.Error(err)
+
+	// Directory pointing to itself.
+	loop := buildTestExif(binary.BigEndian, nil, nil, nil)
+	binary.BigEndian.PutUint32(loop[exifHeaderSize+2+8:], exifHeaderSize)
+	_, err = ParseExif(loop)
+	assert.Error(err)
+}
+
+func TestSplitExifMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	if data, err := splitExifMetadata([]byte("\x00\x00\x00\x06Exif\x00\x00MM")); assert.NoError(err) {
+		assert.Equal([]byte("MM"), data)
+	}
+	_, err := splitExifMetadata([]byte("\x00\x00\x00\x10MM"))
+	assert.Error(err)
+	_, err = splitExifMetadata([]byte("\x00"))
+	assert.Error(err)
+}
+
+func TestEditExif(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	order := binary.LittleEndian
+	data := buildTestExif(order, []testExifEntry{
+		{exifTagMake, exifTypeASCII, 6, []byte("Apple\x00")},
+		{exifTagOrientation, exifTypeShort, 1, order.AppendUint16(nil, 6)},
+	}, []testExifEntry{
+		{exifTagExposureTime, exifTypeRational, 1, testRationals(order, 1, 125)},
+		{uint16(ExifTagBodySerialNumber), exifTypeASCII, 9, []byte("12345678\x00")},
+	}, []testExifEntry{
+		{exifTagGPSLatitudeRef, exifTypeASCII, 2, []byte("N\x00")},
+		{exifTagGPSLatitude, exifTypeRational, 3, testRationals(order, 52, 1, 30, 1, 0, 1)},
+		{exifTagGPSLongitudeRef, exifTypeASCII, 2, []byte("E\x00")},
+		{exifTagGPSLongitude, exifTypeRational, 3, testRationals(order, 13, 1, 15, 1, 36, 1)},
+	})
+
+	orig, err := ParseExif(data)
+	require.NoError(err)
+	require.NotNil(orig.GPS)
+
+	e := orig.Clone()
+	e.RemoveGPS()
+	e.RemoveTag(ExifTagBodySerialNumber)
+	require.NoError(e.SetOrientation(1))
+	assert.Error(e.SetOrientation(9))
+
+	parsed, err := ParseExif(e.Bytes())
+	require.NoError(err)
+	assert.Nil(parsed.GPS)
+	assert.Equal(1, parsed.Orientation)
+	assert.Equal("Apple", parsed.Make)
+	assert.InDelta(1.0/125, parsed.ExposureTime, 1e-9)
+	assert.Nil(parsed.exif.find(uint16(ExifTagBodySerialNumber)))
+	assert.Equal(append([]byte{0, 0, 0, 0}, e.Bytes()...), e.MetadataBytes())
+
+	// The original data must not be modified.
+	assert.Equal(data, orig.Raw)
+	assert.Equal(6, orig.Orientation)
+	assert.NotNil(orig.GPS)
+}
+
+func TestEditExifUnsorted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const unknownType = 99
+	order := binary.BigEndian
+	data := buildTestExif(order, []testExifEntry{
+		{exifTagOrientation, exifTypeShort, 1, order.AppendUint16(nil, 6)},
+		{exifTagModel, exifTypeASCII, 10, []byte("iPhone 15\x00")},
+		{exifTagMake, exifTypeASCII, 6, []byte("Apple\x00")},
+		{0x0200, unknownType, 1, []byte{1, 2, 3, 4}},
+	}, nil, nil)
+
+	e, err := ParseExif(data)
+	require.NoError(err)
+	assert.Equal(6, e.Orientation)
+	require.NoError(e.SetOrientation(3))
+	e.SetMake("Example")
+
+	parsed, err := ParseExif(e.Bytes())
+	require.NoError(err)
+	assert.Equal(3, parsed.Orientation)
+	assert.Equal("Example", parsed.Make)
+	assert.Equal("iPhone 15", parsed.Model)
+
+	var tags []uint16
+	for _, entry := range parsed.ifd0.entries {
+		tags = append(tags, entry.tag)
+	}
+	assert.Equal([]uint16{exifTagMake, exifTagModel, exifTagOrientation, 0x0200, exifTagExifIFD, exifTagGPSIFD}, tags)
+	if unknown := parsed.ifd0.find(0x0200); assert.NotNil(unknown) {
+		assert.EqualValues(unknownType, unknown.typ)
+		assert.Equal([]byte{1, 2, 3, 4}, unknown.value)
+	}
+}
+
+func TestBuildExif(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.FixedZone("", 3600))
+	e := NewExif()
+	e.SetMake("Example")
+	e.SetModel("Model 1")
+	e.SetDateTime(now)
+	require.NoError(e.SetOrientation(8))
+
+	parsed, err := ParseExif(e.Bytes())
+	require.NoError(err)
+	assert.Equal("Example", parsed.Make)
+	assert.Equal("Model 1", parsed.Model)
+	assert.Equal(8, parsed.Orientation)
+	assert.True(now.Equal(parsed.DateTime), parsed.DateTime)
+	assert.Equal(e.Raw, parsed.Raw)
+}
+
+func TestZeroValueExif(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.Empty(new(Exif).Bytes())
+
+	var e Exif
+	e.SetMake("Example")
+	e.SetModel("Model 1")
+	e.SetDateTime(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	require.NoError(e.SetOrientation(6))
+	e.RemoveGPS()
+	e.RemoveTag(ExifTagBodySerialNumber)
+
+	parsed, err := ParseExif(e.Bytes())
+	require.NoError(err)
+	assert.Equal("Example", parsed.Make)
+	assert.Equal("Model 1", parsed.Model)
+	assert.Equal(6, parsed.Orientation)
+
+	var removed Exif
+	removed.RemoveTag(ExifTagBodySerialNumber)
+	assert.Equal("", removed.Make)
+	assert.Empty((&Exif{}).Clone().Bytes())
+}
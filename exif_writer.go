@@ -0,0 +1,353 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"time"
+)
+
+// ExifTag is the numeric id of an EXIF field.
+type ExifTag uint16
+
+// EXIF tags that commonly contain personal information.
+const (
+	// ExifTagMakerNote contains manufacturer specific information.
+	ExifTagMakerNote ExifTag = 0x927c
+	// ExifTagCameraOwnerName is the name of the owner of the camera.
+	ExifTagCameraOwnerName ExifTag = 0xa430
+	// ExifTagBodySerialNumber is the serial number of the camera.
+	ExifTagBodySerialNumber ExifTag = 0xa431
+	// ExifTagLensSerialNumber is the serial number of the lens.
+	ExifTagLensSerialNumber ExifTag = 0xa435
+)
+
+// NewExif creates empty EXIF metadata that can be filled using the setters.
+func NewExif() *Exif {
+	e := &Exif{
+		order: binary.BigEndian,
+		ifd0:  &exifIFD{},
+	}
+	e.refresh()
+	return e
+}
+
+func (d *exifIFD) clone() *exifIFD {
+	if d == nil {
+		return nil
+	}
+
+	result := &exifIFD{
+		entries: make([]exifEntry, len(d.entries)),
+	}
+	for idx, entry := range d.entries {
+		entry.value = slices.Clone(entry.value)
+		result.entries[idx] = entry
+	}
+	return result
+}
+
+// set adds the entry or replaces an existing entry with the same tag while
+// keeping the entries sorted by tag.
+func (d *exifIFD) set(entry exifEntry) {
+	idx, found := slices.BinarySearchFunc(d.entries, entry.tag, func(e exifEntry, tag uint16) int {
+		return int(e.tag) - int(tag)
+	})
+	if found {
+		d.entries[idx] = entry
+	} else {
+		d.entries = slices.Insert(d.entries, idx, entry)
+	}
+}
+
+func (d *exifIFD) remove(tag uint16) {
+	if d == nil {
+		return
+	}
+
+	d.entries = slices.DeleteFunc(d.entries, func(e exifEntry) bool {
+		return e.tag == tag
+	})
+}
+
+func (d *exifIFD) size() int {
+	return 2 + len(d.entries)*exifEntrySize + 4
+}
+
+func (e *Exif) newLong(tag uint16, value uint32) exifEntry {
+	return exifEntry{
+		tag:   tag,
+		typ:   exifTypeLong,
+		count: 1,
+		value: e.order.AppendUint32(nil, value),
+	}
+}
+
+func newExifString(tag uint16, value string) exifEntry {
+	data := append([]byte(value), 0)
+	return exifEntry{
+		tag:   tag,
+		typ:   exifTypeASCII,
+		count: uint32(len(data)),
+		value: data,
+	}
+}
+
+// Clone returns a copy of the EXIF metadata that can be modified without
+// changing the original.
+func (e *Exif) Clone() *Exif {
+	result := *e
+	result.Raw = slices.Clone(e.Raw)
+	result.ifd0 = e.ifd0.clone()
+	result.exif = e.exif.clone()
+	result.gps = e.gps.clone()
+	result.interop = e.interop.clone()
+	result.ifd1 = e.ifd1.clone()
+	result.thumbnail = slices.Clone(e.thumbnail)
+	if e.GPS != nil {
+		gps := *e.GPS
+		result.GPS = &gps
+	}
+	return &result
+}
+
+// refresh serializes the directories to Raw and updates the public fields.
+func (e *Exif) refresh() {
+	e.Raw = e.serialize()
+	e.update()
+}
+
+// serialize writes the directories as TIFF payload. Offsets of all values
+// are recalculated, so manufacturer specific data (MakerNote) that contains
+// absolute offsets might not be readable afterwards. The same applies to
+// entries with unknown types which are written back unchanged.
+func (e *Exif) serialize() []byte {
+	order := e.order
+	// Pointers to sub directories are updated below, make sure they exist
+	// so the layout can be calculated.
+	pointers := []struct {
+		parent *exifIFD
+		tag    uint16
+		child  *exifIFD
+	}{
+		{e.ifd0, exifTagExifIFD, e.exif},
+		{e.ifd0, exifTagGPSIFD, e.gps},
+		{e.exif, exifTagInteropIFD, e.interop},
+	}
+	for _, p := range pointers {
+		if p.parent == nil {
+			continue
+		}
+
+		if p.child == nil {
+			p.parent.remove(p.tag)
+		} else {
+			p.parent.set(e.newLong(p.tag, 0))
+		}
+	}
+	if e.ifd1 != nil {
+		if len(e.thumbnail) > 0 {
+			e.ifd1.set(e.newLong(exifTagThumbnailOffset, 0))
+			e.ifd1.set(e.newLong(exifTagThumbnailLength, uint32(len(e.thumbnail))))
+		} else {
+			e.ifd1.remove(exifTagThumbnailOffset)
+			e.ifd1.remove(exifTagThumbnailLength)
+		}
+	}
+
+	ifds := []*exifIFD{e.ifd0, e.exif, e.gps, e.interop, e.ifd1}
+	offsets := make(map[*exifIFD]int, len(ifds))
+	pos := exifHeaderSize
+	for _, ifd := range ifds {
+		if ifd != nil {
+			offsets[ifd] = pos
+			pos += ifd.size()
+		}
+	}
+	values := make(map[*exifEntry]int)
+	for _, ifd := range ifds {
+		if ifd == nil {
+			continue
+		}
+
+		for idx := range ifd.entries {
+			entry := &ifd.entries[idx]
+			if len(entry.value) > exifMaxInlineValueLength {
+				values[entry] = pos
+				// Values must start on a word boundary.
+				pos += (len(entry.value) + 1) &^ 1
+			}
+		}
+	}
+	thumbnailOffset := pos
+
+	for _, p := range pointers {
+		if p.parent != nil && p.child != nil {
+			p.parent.set(e.newLong(p.tag, uint32(offsets[p.child])))
+		}
+	}
+	if e.ifd1 != nil && len(e.thumbnail) > 0 {
+		e.ifd1.set(e.newLong(exifTagThumbnailOffset, uint32(thumbnailOffset)))
+	}
+
+	result := make([]byte, 0, thumbnailOffset+len(e.thumbnail))
+	if order.Uint16([]byte{1, 0}) == 1 {
+		result = append(result, 'I', 'I')
+	} else {
+		result = append(result, 'M', 'M')
+	}
+	result = order.AppendUint16(result, 42)
+	result = order.AppendUint32(result, uint32(offsets[e.ifd0]))
+	for idx, ifd := range ifds {
+		if ifd == nil {
+			continue
+		}
+
+		result = order.AppendUint16(result, uint16(len(ifd.entries)))
+		for i := range ifd.entries {
+			entry := &ifd.entries[i]
+			result = order.AppendUint16(result, entry.tag)
+			result = order.AppendUint16(result, entry.typ)
+			result = order.AppendUint32(result, entry.count)
+			if offset, found := values[entry]; found {
+				result = order.AppendUint32(result, uint32(offset))
+			} else {
+				var value [exifMaxInlineValueLength]byte
+				copy(value[:], entry.value)
+				result = append(result, value[:]...)
+			}
+		}
+
+		var next uint32
+		if idx == 0 && e.ifd1 != nil {
+			next = uint32(offsets[e.ifd1])
+		}
+		result = order.AppendUint32(result, next)
+	}
+	for _, ifd := range ifds {
+		if ifd == nil {
+			continue
+		}
+
+		for idx := range ifd.entries {
+			entry := &ifd.entries[idx]
+			if _, found := values[entry]; found {
+				result = append(result, entry.value...)
+				if len(entry.value)%2 != 0 {
+					result = append(result, 0)
+				}
+			}
+		}
+	}
+	return append(result, e.thumbnail...)
+}
+
+// Bytes returns the EXIF metadata as TIFF payload, e.g. to be passed to
+// Context.AddExifMetadata.
+func (e *Exif) Bytes() []byte {
+	return e.Raw
+}
+
+// MetadataBytes returns the EXIF metadata as it is stored in HEIF files,
+// i.e. the TIFF payload prefixed with the offset to the TIFF header.
+func (e *Exif) MetadataBytes() []byte {
+	result := make([]byte, 4, 4+len(e.Raw))
+	return append(result, e.Raw...)
+}
+
+// init prepares an Exif that was not created by NewExif or ParseExif, so the
+// zero value can be modified with the setters.
+func (e *Exif) init() {
+	if e.order == nil {
+		e.order = binary.BigEndian
+	}
+	if e.ifd0 == nil {
+		e.ifd0 = &exifIFD{}
+	}
+}
+
+// SetOrientation sets the orientation as defined by the EXIF specification,
+// i.e. 1 (normal) to 8. Use 1 after the pixel data has been rotated.
+func (e *Exif) SetOrientation(orientation int) error {
+	if orientation < 1 || orientation > 8 {
+		return errors.New("invalid orientation")
+	}
+
+	e.init()
+	e.ifd0.set(exifEntry{
+		tag:   exifTagOrientation,
+		typ:   exifTypeShort,
+		count: 1,
+		value: e.order.AppendUint16(nil, uint16(orientation)),
+	})
+	e.refresh()
+	return nil
+}
+
+// SetMake sets the manufacturer of the camera.
+func (e *Exif) SetMake(value string) {
+	e.init()
+	e.ifd0.set(newExifString(exifTagMake, value))
+	e.refresh()
+}
+
+// SetModel sets the model of the camera.
+func (e *Exif) SetModel(value string) {
+	e.init()
+	e.ifd0.set(newExifString(exifTagModel, value))
+	e.refresh()
+}
+
+// SetDateTime sets the time the image was taken.
+func (e *Exif) SetDateTime(t time.Time) {
+	e.init()
+	if e.exif == nil {
+		e.exif = &exifIFD{}
+	}
+
+	value := t.Format(exifDateTimeFormat)
+	e.ifd0.set(newExifString(exifTagDateTime, value))
+	e.exif.set(newExifString(exifTagDateTimeOriginal, value))
+	e.exif.set(newExifString(exifTagOffsetTimeOrig, t.Format("-07:00")))
+	e.refresh()
+}
+
+// RemoveGPS removes all location information.
+func (e *Exif) RemoveGPS() {
+	e.init()
+	e.gps = nil
+	e.refresh()
+}
+
+// RemoveTag removes the field with the given tag from all directories.
+func (e *Exif) RemoveTag(tag ExifTag) {
+	e.init()
+	for _, ifd := range []*exifIFD{e.ifd0, e.exif, e.gps, e.interop, e.ifd1} {
+		ifd.remove(uint16(tag))
+	}
+	e.refresh()
+}
+
+// AddExif adds the EXIF metadata to the image.
+func (c *Context) AddExif(handle *ImageHandle, e *Exif) error {
+	return c.AddExifMetadata(handle, e.Bytes())
+}
@@ -0,0 +1,103 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+import "C"
+
+import (
+	"unsafe"
+)
+
+// FileTypeResult is the result of checking the file type of data.
+type FileTypeResult C.enum_heif_filetype_result
+
+const (
+	// FileTypeNo is returned for data that is no HEIF file.
+	FileTypeNo FileTypeResult = C.heif_filetype_no
+	// FileTypeYesSupported is returned for HEIF files that can be read.
+	FileTypeYesSupported FileTypeResult = C.heif_filetype_yes_supported
+	// FileTypeYesUnsupported is returned for HEIF files that can not be read.
+	FileTypeYesUnsupported FileTypeResult = C.heif_filetype_yes_unsupported
+	// FileTypeMaybe is returned if there is not enough data to decide.
+	FileTypeMaybe FileTypeResult = C.heif_filetype_maybe
+)
+
+func dataPointer(data []byte) (*C.uint8_t, C.int) {
+	if len(data) == 0 {
+		return nil, 0
+	}
+
+	return (*C.uint8_t)(unsafe.Pointer(&data[0])), C.int(len(data))
+}
+
+func brandToString(brand C.heif_brand2) string {
+	var fourcc [4]C.char
+	C.heif_brand_to_fourcc(brand, &fourcc[0])
+	return C.GoStringN(&fourcc[0], 4)
+}
+
+// CheckFileType checks if the data is a HEIF file. At least the first 12
+// bytes of the file should be passed.
+func CheckFileType(data []byte) FileTypeResult {
+	ptr, size := dataPointer(data)
+	return FileTypeResult(C.heif_check_filetype(ptr, size))
+}
+
+// ReadMainBrand returns the main brand of the file, e.g. "heic" or "avif",
+// or an empty string if the data is no HEIF file.
+func ReadMainBrand(data []byte) string {
+	ptr, size := dataPointer(data)
+	brand := C.heif_read_main_brand(ptr, size)
+	if brand == 0 {
+		return ""
+	}
+
+	return brandToString(brand)
+}
+
+// ListCompatibleBrands returns the compatible brands of the file.
+func ListCompatibleBrands(data []byte) ([]string, error) {
+	ptr, size := dataPointer(data)
+	var brands *C.heif_brand2
+	var count C.int
+	err := C.heif_list_compatible_brands(ptr, size, &brands, &count)
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+	defer C.heif_free_list_of_compatible_brands(brands)
+
+	result := make([]string, 0, int(count))
+	for i := 0; i < int(count); i++ {
+		result = append(result, brandToString(*brands))
+		brands = nextPointer(brands)
+	}
+	return result, nil
+}
+
+// GetFileMimeType returns the MIME type of the file, e.g. "image/heic", or an
+// empty string if the data is no HEIF file.
+func GetFileMimeType(data []byte) string {
+	ptr, size := dataPointer(data)
+	return C.GoString(C.heif_get_file_mime_type(ptr, size))
+}
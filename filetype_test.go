@@ -0,0 +1,48 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileType(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.heic")
+	require.NoError(err)
+
+	assert.Equal(FileTypeYesSupported, CheckFileType(data))
+	assert.Equal("mif1", ReadMainBrand(data))
+	assert.Contains([]string{"image/heic", "image/heif"}, GetFileMimeType(data))
+	if brands, err := ListCompatibleBrands(data); assert.NoError(err) {
+		assert.Contains(brands, "heic")
+	}
+
+	jpeg, err := os.ReadFile("testdata/example-1.jpg")
+	require.NoError(err)
+	assert.Equal(FileTypeNo, CheckFileType(jpeg))
+	assert.Equal("", ReadMainBrand(jpeg))
+}
@@ -96,7 +96,7 @@ func convertBool[T C.uchar | C.int](value bool) T { // nolint
 }
 
 func nextPointer[T any](value *T) *T {
-	return (*T)(unsafe.Pointer(uintptr(unsafe.Pointer(value)) + unsafe.Sizeof(value)))
+	return (*T)(unsafe.Pointer(uintptr(unsafe.Pointer(value)) + unsafe.Sizeof(*value)))
 }
 
 func makePointer[T any](value T) *T {
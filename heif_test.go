@@ -20,8 +20,10 @@
 package libheif
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"os"
 	"path"
 	"runtime"
@@ -48,9 +50,22 @@ func CheckHeifImage(t *testing.T, handle *ImageHandle, thumbnail bool) {
 	t.Run("properties", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
+		assert.NotZero(handle.GetItemID())
 		handle.GetWidth()
 		handle.GetHeight()
+		assert.Positive(handle.GetIspeWidth())
+		assert.Positive(handle.GetIspeHeight())
 		handle.HasAlphaChannel()
+		handle.IsPremultipliedAlpha()
+		assert.Positive(handle.GetLumaBitsPerPixel())
+		handle.GetChromaBitsPerPixel()
+		_, _, err := handle.GetPreferredDecodingColorspace()
+		assert.NoError(err)
+		if haveTransformationProperties {
+			if transformations, err := handle.GetTransformations(); assert.NoError(err) {
+				assert.Empty(transformations)
+			}
+		}
 		handle.HasDepthImage()
 		count := handle.GetNumberOfDepthImages()
 		ids := handle.GetListOfDepthImageIDs()
@@ -72,6 +87,9 @@ func CheckHeifImage(t *testing.T, handle *ImageHandle, thumbnail bool) {
 
 		meta_ids := handle.GetMetadataBlockIDs("")
 		assert.Empty(meta_ids)
+		if exif, err := handle.GetExif(); assert.NoError(err) {
+			assert.Nil(exif)
+		}
 	})
 
 	decodeTests := []decodeTest{
@@ -166,9 +184,314 @@ func TestReadImage(t *testing.T) {
 	img, format2, err := image.Decode(fp)
 	require.NoError(err)
 	assert.Equal("heif", format2)
+	assert.Equal(config.ColorModel, img.ColorModel())
 
 	r := img.Bounds()
 	if config.Width != (r.Max.X-r.Min.X) || config.Height != (r.Max.Y-r.Min.Y) {
 		fmt.Printf("Image size %+v does not match config %+v\n", r, config)
 	}
 }
+
+func TestDecodeOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	filename := path.Join("testdata", "example.heic")
+	data, err := os.ReadFile(filename)
+	require.NoError(err)
+
+	options, err := NewDecodingOptions()
+	require.NoError(err)
+	options.SetIgnoreTransformations(true)
+	options.SetConvertHDRTo8Bit(true)
+
+	opts := &DecodeOptions{
+		Options: options,
+	}
+	config, err := DecodeConfig(bytes.NewReader(data), opts)
+	require.NoError(err)
+
+	img, err := Decode(bytes.NewReader(data), opts)
+	require.NoError(err)
+	assert.Equal(config.ColorModel, img.ColorModel())
+	assert.Equal(config.Width, img.Bounds().Dx())
+	assert.Equal(config.Height, img.Bounds().Dy())
+
+	SetDefaultDecodeOptions(opts)
+	defer SetDefaultDecodeOptions(nil)
+	assert.Same(options, GetDefaultDecodeOptions().Options)
+
+	img2, format, err := image.Decode(bytes.NewReader(data))
+	require.NoError(err)
+	assert.Equal("heif", format)
+	assert.Equal(img.Bounds(), img2.Bounds())
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, err := NewContext()
+	require.NoError(err, "Can't create context")
+
+	filename := path.Join("testdata", "example.heic")
+	require.NoError(ctx.ReadFromFile(filename))
+
+	handle, err := ctx.GetPrimaryImageHandle()
+	require.NoError(err)
+
+	ctx.Close()
+	ctx.Close()
+	assert.Equal(0, ctx.GetNumberOfTopLevelImages())
+	_, err = ctx.GetPrimaryImageHandle()
+	assert.ErrorIs(err, ErrClosed)
+	_, err = ctx.NewEncoder(CompressionHEVC)
+	assert.ErrorIs(err, ErrClosed)
+
+	// The handle can still be decoded after the context has been closed.
+	options, err := NewDecodingOptions()
+	require.NoError(err)
+	img, err := handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, options)
+	require.NoError(err)
+	assert.Positive(handle.GetWidth())
+	// Item properties are only available through the context.
+	_, err = handle.GetTransformations()
+	assert.ErrorIs(err, ErrClosed)
+
+	options.Close()
+	options.Close()
+	assert.False(options.GetIgnoreTransformations())
+	_, err = handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, options)
+	assert.ErrorIs(err, ErrClosed)
+
+	handle.Close()
+	handle.Close()
+	assert.Equal(0, handle.GetWidth())
+	assert.Equal(-1, handle.GetLumaBitsPerPixel())
+	assert.Equal(-1, handle.GetChromaBitsPerPixel())
+	_, err = handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, nil)
+	assert.ErrorIs(err, ErrClosed)
+	_, err = handle.GetTransformations()
+	assert.ErrorIs(err, ErrClosed)
+
+	out, err := NewContext()
+	require.NoError(err, "Can't create context")
+	defer out.Close()
+	enc, err := out.NewEncoder(CompressionHEVC)
+	require.NoError(err)
+	encOpts, err := NewEncodingOptions()
+	require.NoError(err)
+
+	encOpts.Close()
+	encOpts.Close()
+	_, err = out.EncodeImage(img, enc, encOpts)
+	assert.ErrorIs(err, ErrClosed)
+
+	enc.Close()
+	enc.Close()
+	assert.ErrorIs(enc.SetQuality(50), ErrClosed)
+	assert.Empty(enc.ListParameters())
+
+	img.Close()
+	img.Close()
+	_, err = img.GetImage()
+	assert.ErrorIs(err, ErrClosed)
+	_, err = img.ScaleImage(10, 10)
+	assert.ErrorIs(err, ErrClosed)
+
+	// Objects that are closed are not freed again by the garbage collector.
+	runtime.GC()
+}
+
+func checkGridImage(t *testing.T, threads int, tile image.Image) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, err := NewContext()
+	require.NoError(err, "Can't create context")
+	defer ctx.Close()
+	if threads >= 0 {
+		require.NoError(ctx.SetMaxDecodingThreads(threads))
+	}
+
+	filename := path.Join("testdata", "example-grid.heic")
+	require.NoError(ctx.ReadFromFile(filename))
+
+	handle, err := ctx.GetPrimaryImageHandle()
+	require.NoError(err)
+	defer handle.Close()
+
+	img, err := handle.Decode(nil)
+	require.NoError(err)
+
+	size := tile.Bounds().Size()
+	require.Equal(image.Rect(0, 0, 2*size.X, 2*size.Y), img.Bounds())
+	for _, offset := range []image.Point{{0, 0}, {size.X, 0}, {0, size.Y}, {size.X, size.Y}} {
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				if !assert.Equal(tile.At(x, y), img.At(offset.X+x, offset.Y+y), "pixel %d/%d of tile at %v", x, y, offset) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestMaxDecodingThreads(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The grid image consists of 2x2 tiles that all contain the thumbnail of
+	// the primary image of "example.heic".
+	ctx, err := NewContext()
+	require.NoError(err, "Can't create context")
+	defer ctx.Close()
+	require.NoError(ctx.ReadFromFile(path.Join("testdata", "example.heic")))
+	primary, err := ctx.GetPrimaryImageHandle()
+	require.NoError(err)
+	ids := primary.GetListOfThumbnailIDs()
+	require.Len(ids, 1)
+	thumbnail, err := primary.GetThumbnail(ids[0])
+	require.NoError(err)
+	tile, err := thumbnail.Decode(nil)
+	require.NoError(err)
+
+	for _, threads := range []int{0, 1, 4, 16} {
+		t.Run(fmt.Sprintf("threads%d", threads), func(t *testing.T) {
+			checkGridImage(t, threads, tile)
+		})
+	}
+
+	assert.Equal(-1, GetDefaultMaxDecodingThreads())
+	SetDefaultMaxDecodingThreads(1)
+	defer SetDefaultMaxDecodingThreads(-1)
+	assert.Equal(1, GetDefaultMaxDecodingThreads())
+	t.Run("default", func(t *testing.T) {
+		checkGridImage(t, -1, tile)
+	})
+
+	assert.Error(ctx.SetMaxDecodingThreads(-1))
+	ctx.Close()
+	assert.ErrorIs(ctx.SetMaxDecodingThreads(1), ErrClosed)
+}
+
+func newTestImage10Bit(t *testing.T, width, height int, pixel func(x, y int) (r, g, b uint16)) *Image {
+	require := require.New(t)
+
+	img, err := NewImage(width, height, ColorspaceRGB, ChromaInterleavedRRGGBB_BE)
+	require.NoError(err)
+	plane, err := img.NewPlane(ChannelInterleaved, width, height, 10)
+	require.NoError(err)
+
+	pix := make([]byte, width*height*6)
+	pos := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := pixel(x, y)
+			for _, v := range []uint16{r, g, b} {
+				pix[pos] = byte(v >> 8)
+				pix[pos+1] = byte(v & 0xff)
+				pos += 2
+			}
+		}
+	}
+	plane.setData(pix, width*6)
+	return img
+}
+
+func expand10Bit(v uint16) uint16 {
+	return (v << 6) | (v >> 4)
+}
+
+func TestGetImage10Bit(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pixel := func(x, y int) (uint16, uint16, uint16) {
+		return uint16(x * 100), uint16(1023 - y*100), uint16((x + y) * 50)
+	}
+	img := newTestImage10Bit(t, 8, 6, pixel)
+	defer img.Close()
+
+	i, err := img.GetImage()
+	require.NoError(err)
+	rgba, ok := i.(*image.RGBA64)
+	require.True(ok, "expected *image.RGBA64, got %T", i)
+	assert.Equal(8*8, rgba.Stride)
+	assert.Equal(image.Rect(0, 0, 8, 6), rgba.Bounds())
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			r, g, b := pixel(x, y)
+			assert.Equal(color.RGBA64{
+				R: expand10Bit(r),
+				G: expand10Bit(g),
+				B: expand10Bit(b),
+				A: 0xffff,
+			}, rgba.RGBA64At(x, y), "pixel at %d/%d", x, y)
+		}
+	}
+}
+
+func TestDecode10Bit(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const width, height = 64, 64
+	img := newTestImage10Bit(t, width, height, func(x, y int) (uint16, uint16, uint16) {
+		if y < height/2 {
+			return 1023, 0, 0
+		}
+		return 0, 0, 1023
+	})
+	defer img.Close()
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	defer ctx.Close()
+	encoder, err := ctx.NewEncoder(CompressionHEVC)
+	require.NoError(err)
+	defer encoder.Close()
+	require.NoError(encoder.SetQuality(90))
+	_, err = ctx.EncodeImage(img, encoder, nil)
+	require.NoError(err)
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+
+	config, err := DecodeConfig(bytes.NewReader(out.Bytes()), nil)
+	require.NoError(err)
+	assert.Equal(color.RGBA64Model, config.ColorModel)
+
+	decoded, err := Decode(bytes.NewReader(out.Bytes()), nil)
+	require.NoError(err)
+	rgba, ok := decoded.(*image.RGBA64)
+	require.True(ok, "expected *image.RGBA64, got %T", decoded)
+	assert.Equal(image.Rect(0, 0, width, height), rgba.Bounds())
+
+	near := func(expected, actual uint16) bool {
+		diff := int(expected) - int(actual)
+		return diff > -0x1000 && diff < 0x1000
+	}
+	for _, p := range []image.Point{{0, 0}, {width - 1, 0}, {0, height - 1}, {width - 1, height - 1}} {
+		c := rgba.RGBA64At(p.X, p.Y)
+		if p.Y < height/2 {
+			assert.True(near(0xffff, c.R) && near(0, c.B), "pixel at %v should be red, got %+v", p, c)
+		} else {
+			assert.True(near(0, c.R) && near(0xffff, c.B), "pixel at %v should be blue, got %+v", p, c)
+		}
+		assert.Equal(uint16(0xffff), c.A)
+	}
+}
+
+func TestNextPointer(t *testing.T) {
+	assert := assert.New(t)
+
+	// Elements smaller and larger than a pointer must both be stepped over
+	// by their own size.
+	ints := []int32{1, 2, 3}
+	assert.Same(&ints[1], nextPointer(&ints[0]))
+	assert.Equal(int32(3), *nextPointer(nextPointer(&ints[0])))
+
+	values := [][2]uint64{{1, 2}, {3, 4}}
+	assert.Same(&values[1], nextPointer(&values[0]))
+}
@@ -0,0 +1,479 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package httpheif provides an HTTP handler that converts and resizes HEIF
+// images.
+package httpheif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strukturag/libheif-go"
+)
+
+// Default limits of a Handler.
+const (
+	DefaultMaxUploadSize = 32 << 20
+	DefaultMaxPixels     = 64 << 20
+	DefaultMaxOutputSize = 4096
+	DefaultTimeout       = 30 * time.Second
+	DefaultQuality       = 85
+)
+
+// Fit modes for resizing images to the requested width and height.
+const (
+	// FitContain scales the image to fit into the requested size.
+	FitContain = "contain"
+	// FitCover scales the image to cover the requested size and crops it.
+	FitCover = "cover"
+	// FitFill scales the image to the requested size, ignoring the aspect
+	// ratio.
+	FitFill = "fill"
+)
+
+// Output formats.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatHEIC = "heic"
+	FormatAVIF = "avif"
+)
+
+// Handler converts HEIF images that are uploaded with POST requests or read
+// from a filesystem with GET requests. The output is controlled by the query
+// parameters "w" and "h" (size in pixels), "fit" (contain, cover or fill),
+// "format" (jpeg, png, heic or avif) and "quality" (1-100).
+//
+// Limits that are zero use the defaults.
+type Handler struct {
+	// FS is used to serve GET requests, the path of the request is the name
+	// of the file. If nil, only uploads are accepted.
+	FS fs.FS
+	// MaxUploadSize is the maximum size of uploaded and read files in bytes.
+	MaxUploadSize int64
+	// MaxPixels is the maximum number of pixels of an input image.
+	MaxPixels int
+	// MaxOutputSize is the maximum width and height of the output image.
+	MaxOutputSize int
+	// Timeout is the maximum time to process a request.
+	Timeout time.Duration
+	// Quality is used if no quality is requested.
+	Quality int
+	// MaxConcurrent is the maximum number of images that are converted at
+	// the same time, further requests wait for a free slot. Defaults to the
+	// number of CPUs. Changes after the first request are ignored.
+	MaxConcurrent int
+
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+// NewHandler creates a handler with the default limits that reads files from
+// fsys. Pass nil to only accept uploads.
+func NewHandler(fsys fs.FS) *Handler {
+	return &Handler{
+		FS: fsys,
+	}
+}
+
+func valueOrDefault[T int | int64 | time.Duration](value T, defaultValue T) T {
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func newHTTPError(status int, format string, args ...any) error {
+	return &httpError{
+		status:  status,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+type request struct {
+	width   int
+	height  int
+	fit     string
+	format  string
+	quality int
+}
+
+func parseSize(value string, name string, limit int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid %s %q", name, value)
+	} else if size > limit {
+		return 0, newHTTPError(http.StatusBadRequest, "%s %d exceeds limit %d", name, size, limit)
+	}
+
+	return size, nil
+}
+
+func (h *Handler) parseRequest(r *http.Request) (*request, error) {
+	query := r.URL.Query()
+	req := &request{
+		fit:     FitContain,
+		format:  FormatJPEG,
+		quality: valueOrDefault(h.Quality, DefaultQuality),
+	}
+
+	var err error
+	maxOutputSize := valueOrDefault(h.MaxOutputSize, DefaultMaxOutputSize)
+	if req.width, err = parseSize(query.Get("w"), "width", maxOutputSize); err != nil {
+		return nil, err
+	}
+	if req.height, err = parseSize(query.Get("h"), "height", maxOutputSize); err != nil {
+		return nil, err
+	}
+
+	if fit := query.Get("fit"); fit != "" {
+		switch fit {
+		case FitContain, FitCover, FitFill:
+			req.fit = fit
+		default:
+			return nil, newHTTPError(http.StatusBadRequest, "unsupported fit %q", fit)
+		}
+	}
+
+	if format := strings.ToLower(query.Get("format")); format != "" {
+		switch format {
+		case "jpg":
+			req.format = FormatJPEG
+		case FormatJPEG, FormatPNG, FormatHEIC, FormatAVIF:
+			req.format = format
+		default:
+			return nil, newHTTPError(http.StatusBadRequest, "unsupported format %q", format)
+		}
+	}
+
+	if quality := query.Get("quality"); quality != "" {
+		q, err := strconv.Atoi(quality)
+		if err != nil || q < 1 || q > 100 {
+			return nil, newHTTPError(http.StatusBadRequest, "invalid quality %q", quality)
+		}
+
+		req.quality = q
+	}
+
+	return req, nil
+}
+
+func (h *Handler) readInput(r *http.Request) ([]byte, error) {
+	var reader io.Reader
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if h.FS == nil {
+			return nil, newHTTPError(http.StatusMethodNotAllowed, "only uploads are supported")
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		f, err := h.FS.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, newHTTPError(http.StatusNotFound, "not found")
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		reader = f
+	case http.MethodPost, http.MethodPut:
+		reader = r.Body
+	default:
+		return nil, newHTTPError(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+
+	maxUploadSize := valueOrDefault(h.MaxUploadSize, DefaultMaxUploadSize)
+	data, err := io.ReadAll(io.LimitReader(reader, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxUploadSize {
+		return nil, newHTTPError(http.StatusRequestEntityTooLarge, "image exceeds %d bytes", maxUploadSize)
+	}
+
+	return data, nil
+}
+
+// targetSize returns the size the image should be scaled to and the size of
+// the final output image.
+func targetSize(width, height int, req *request) (image.Point, image.Point) {
+	w, h := req.width, req.height
+	switch {
+	case w == 0 && h == 0:
+		return image.Pt(width, height), image.Pt(width, height)
+	case w == 0:
+		w = max(1, width*h/height)
+		return image.Pt(w, h), image.Pt(w, h)
+	case h == 0:
+		h = max(1, height*w/width)
+		return image.Pt(w, h), image.Pt(w, h)
+	}
+
+	switch req.fit {
+	case FitFill:
+		return image.Pt(w, h), image.Pt(w, h)
+	case FitCover:
+		// Scale to cover the requested size, the image is cropped later.
+		if width*h > height*w {
+			scaled := image.Pt(max(1, width*h/height), h)
+			return scaled, image.Pt(min(w, scaled.X), h)
+		}
+
+		scaled := image.Pt(w, max(1, height*w/width))
+		return scaled, image.Pt(w, min(h, scaled.Y))
+	default:
+		if width*h > height*w {
+			scaled := image.Pt(w, max(1, height*w/width))
+			return scaled, scaled
+		}
+
+		scaled := image.Pt(max(1, width*h/height), h)
+		return scaled, scaled
+	}
+}
+
+// cropCenter returns the center part of the image with the given size.
+func cropCenter(img image.Image, size image.Point) image.Image {
+	b := img.Bounds()
+	if b.Dx() == size.X && b.Dy() == size.Y {
+		return img
+	}
+
+	offset := image.Pt(b.Min.X+(b.Dx()-size.X)/2, b.Min.Y+(b.Dy()-size.Y)/2)
+	out := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(out, out.Bounds(), img, offset, draw.Src)
+	return out
+}
+
+// decodeScaled decodes the image of the handle and scales it so it covers
+// or fits into the requested size. The native images are released before
+// returning, only the Go image is kept.
+func decodeScaled(ctx context.Context, handle *libheif.ImageHandle, chroma libheif.Chroma, req *request) (image.Image, image.Point, error) {
+	img, err := handle.DecodeImage(libheif.ColorspaceRGB, chroma, nil)
+	if err != nil {
+		return nil, image.Point{}, newHTTPError(http.StatusUnprocessableEntity, "could not decode image: %s", err)
+	}
+	defer img.Close()
+
+	if err := ctx.Err(); err != nil {
+		return nil, image.Point{}, err
+	}
+
+	width := img.GetWidth(libheif.ChannelInterleaved)
+	height := img.GetHeight(libheif.ChannelInterleaved)
+	scaled, size := targetSize(width, height, req)
+	if scaled.X != width || scaled.Y != height {
+		scaledImg, err := img.ScaleImage(scaled.X, scaled.Y)
+		if err != nil {
+			return nil, image.Point{}, fmt.Errorf("could not scale image: %w", err)
+		}
+		defer scaledImg.Close()
+		img = scaledImg
+	}
+
+	out, err := img.GetImage()
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+
+	return out, size, nil
+}
+
+// convert decodes, scales and encodes the image. The native calls can't be
+// interrupted, so the context is checked between the steps to stop working
+// on requests that timed out or were canceled.
+func (h *Handler) convert(ctx context.Context, data []byte, req *request) ([]byte, string, error) {
+	if libheif.CheckFileType(data) != libheif.FileTypeYesSupported {
+		return nil, "", newHTTPError(http.StatusUnsupportedMediaType, "unsupported image format")
+	}
+
+	heifCtx, err := libheif.NewContext()
+	if err != nil {
+		return nil, "", err
+	}
+	defer heifCtx.Close()
+
+	if err := heifCtx.ReadFromMemory(data); err != nil {
+		return nil, "", newHTTPError(http.StatusUnprocessableEntity, "invalid image: %s", err)
+	}
+
+	handle, err := heifCtx.GetPrimaryImageHandle()
+	if err != nil {
+		return nil, "", newHTTPError(http.StatusUnprocessableEntity, "invalid image: %s", err)
+	}
+	defer handle.Close()
+
+	// Check the limits before decoding the image data.
+	if pixels := handle.GetIspeWidth() * handle.GetIspeHeight(); pixels <= 0 || pixels > valueOrDefault(h.MaxPixels, DefaultMaxPixels) {
+		return nil, "", newHTTPError(http.StatusRequestEntityTooLarge, "image has too many pixels")
+	}
+
+	chroma := libheif.ChromaInterleavedRGB
+	if handle.HasAlphaChannel() {
+		chroma = libheif.ChromaInterleavedRGBA
+	}
+
+	out, size, err := decodeScaled(ctx, handle, chroma, req)
+	if err != nil {
+		return nil, "", err
+	}
+	out = cropCenter(out, size)
+
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	switch req.format {
+	case FormatPNG:
+		if err := png.Encode(&buf, out); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	case FormatHEIC, FormatAVIF:
+		compression := libheif.CompressionHEVC
+		if req.format == FormatAVIF {
+			compression = libheif.CompressionAV1
+		}
+
+		result, _, err := libheif.EncodeFromImage(out, compression, libheif.SetEncoderQuality(req.quality))
+		if err != nil {
+			return nil, "", err
+		}
+
+		defer result.Close()
+		if err := result.Write(&buf); err != nil {
+			return nil, "", err
+		}
+
+		data := buf.Bytes()
+		contentType := libheif.GetFileMimeType(data)
+		if contentType == "" {
+			contentType = "image/heif"
+		}
+		return data, contentType, nil
+	default:
+		if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: req.quality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
+	data, contentType, err := h.process(r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			http.Error(w, he.message, he.status)
+		} else {
+			http.Error(w, "Error processing image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data) // nolint
+	}
+}
+
+func (h *Handler) process(r *http.Request) ([]byte, string, error) {
+	req, err := h.parseRequest(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := h.readInput(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Don't start the expensive conversion if the client is gone or the
+	// request timed out while waiting for a free slot.
+	ctx := r.Context()
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	return h.convert(ctx, data, req)
+}
+
+// acquire waits until less than MaxConcurrent images are converted or the
+// context is done. The returned function must be called to release the slot.
+func (h *Handler) acquire(ctx context.Context) (func(), error) {
+	h.semOnce.Do(func() {
+		h.sem = make(chan struct{}, valueOrDefault(h.MaxConcurrent, runtime.NumCPU()))
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case h.sem <- struct{}{}:
+		return func() {
+			<-h.sem
+		}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := valueOrDefault(h.Timeout, DefaultTimeout)
+	http.TimeoutHandler(http.HandlerFunc(h.serve), timeout, "Timeout while processing image").ServeHTTP(w, r)
+}
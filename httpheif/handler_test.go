@@ -0,0 +1,147 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpheif
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetSize(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tc := range []struct {
+		width, height int
+		req           request
+		scaled, size  image.Point
+	}{
+		{400, 200, request{}, image.Pt(400, 200), image.Pt(400, 200)},
+		{400, 200, request{width: 100}, image.Pt(100, 50), image.Pt(100, 50)},
+		{400, 200, request{height: 100}, image.Pt(200, 100), image.Pt(200, 100)},
+		{400, 200, request{width: 100, height: 100, fit: FitContain}, image.Pt(100, 50), image.Pt(100, 50)},
+		{200, 400, request{width: 100, height: 100, fit: FitContain}, image.Pt(50, 100), image.Pt(50, 100)},
+		{400, 200, request{width: 100, height: 100, fit: FitCover}, image.Pt(200, 100), image.Pt(100, 100)},
+		{200, 400, request{width: 100, height: 100, fit: FitCover}, image.Pt(100, 200), image.Pt(100, 100)},
+		{400, 200, request{width: 100, height: 100, fit: FitFill}, image.Pt(100, 100), image.Pt(100, 100)},
+	} {
+		scaled, size := targetSize(tc.width, tc.height, &tc.req)
+		assert.Equal(tc.scaled, scaled, "%+v", tc)
+		assert.Equal(tc.size, size, "%+v", tc)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := NewHandler(os.DirFS("../testdata"))
+	handler.MaxUploadSize = 16
+	for _, tc := range []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/example.heic?w=abc", "", http.StatusBadRequest},
+		{http.MethodGet, "/example.heic?w=100000", "", http.StatusBadRequest},
+		{http.MethodGet, "/example.heic?fit=stretch", "", http.StatusBadRequest},
+		{http.MethodGet, "/example.heic?format=gif", "", http.StatusBadRequest},
+		{http.MethodGet, "/example.heic?quality=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/missing.heic", "", http.StatusNotFound},
+		{http.MethodGet, "/../go.mod", "", http.StatusNotFound},
+		{http.MethodDelete, "/example.heic", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/", "not an image", http.StatusUnsupportedMediaType},
+		{http.MethodPost, "/", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(tc.status, rec.Code, "%s %s", tc.method, tc.url)
+	}
+
+	uploadOnly := NewHandler(nil)
+	rec := httptest.NewRecorder()
+	uploadOnly.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/example.heic", nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handler := NewHandler(os.DirFS("../testdata"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/example.heic?w=100&h=100&fit=cover&quality=80", nil))
+	require.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal("image/jpeg", rec.Header().Get("Content-Type"))
+	img, err := jpeg.Decode(rec.Body)
+	require.NoError(err)
+	assert.Equal(image.Pt(100, 100), img.Bounds().Size())
+
+	data, err := os.ReadFile("../testdata/example.heic")
+	require.NoError(err)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?w=64&format=heic", bytes.NewReader(data)))
+	require.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains([]string{"image/heic", "image/heif"}, rec.Header().Get("Content-Type"))
+
+	handler.MaxPixels = 100
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/example.heic", nil))
+	assert.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestHandlerMaxConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	handler := NewHandler(os.DirFS("../testdata"))
+	handler.MaxConcurrent = 1
+	release, err := handler.acquire(context.Background())
+	require.NoError(err)
+
+	// All slots are in use, so the request fails once its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = handler.acquire(ctx)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+
+	release()
+	release, err = handler.acquire(context.Background())
+	require.NoError(err)
+	release()
+
+	// Canceled requests are not converted.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/example.heic", nil).WithContext(canceled)
+	_, _, err = handler.process(req)
+	assert.ErrorIs(err, context.Canceled)
+}
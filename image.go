@@ -33,9 +33,11 @@ import (
 )
 
 // Image contains information on a libheif image. It is either returned when
-// decoding images or can be creates to encode an image using libheif.
+// decoding images or can be creates to encode an image using libheif. An
+// image must not be used by multiple goroutines at the same time.
 type Image struct {
-	image *C.struct_heif_image
+	image  *C.struct_heif_image
+	memory int64 // number of bytes accounted in NativeMemoryInUse
 }
 
 // NewImage creates a new image to be used by libheif.
@@ -49,19 +51,40 @@ func NewImage(width, height int, colorspace Colorspace, chroma Chroma) (*Image,
 	if err := convertHeifError(err); err != nil {
 		return nil, err
 	}
+	image.updateMemoryUsage()
 	runtime.SetFinalizer(&image, freeHeifImage)
 	return &image, nil
 }
 
 func freeHeifImage(image *Image) {
+	if image.image == nil {
+		return
+	}
+
 	C.heif_image_release(image.image)
 	image.image = nil
+	nativeMemoryInUse.Add(-image.memory)
+	image.memory = 0
+}
+
+// Close releases the image and its pixel data immediately instead of waiting
+// for the garbage collector. Go images returned by GetImage are copies and can
+// still be used afterwards. It is safe to call Close multiple times, other
+// methods fail with ErrClosed or return zero values after the image has been
+// closed.
+func (img *Image) Close() {
+	runtime.SetFinalizer(img, nil)
+	freeHeifImage(img)
 }
 
 // GetColorspace returns the colorspace of the image.
 func (img *Image) GetColorspace() Colorspace {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return ColorspaceUndefined
+	}
+
 	return Colorspace(C.heif_image_get_colorspace(img.image))
 }
 
@@ -69,6 +92,10 @@ func (img *Image) GetColorspace() Colorspace {
 func (img *Image) GetChromaFormat() Chroma {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return ChromaUndefined
+	}
+
 	return Chroma(C.heif_image_get_chroma_format(img.image))
 }
 
@@ -76,6 +103,10 @@ func (img *Image) GetChromaFormat() Chroma {
 func (img *Image) GetWidth(channel Channel) int {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return 0
+	}
+
 	return int(C.heif_image_get_width(img.image, uint32(channel)))
 }
 
@@ -83,6 +114,10 @@ func (img *Image) GetWidth(channel Channel) int {
 func (img *Image) GetHeight(channel Channel) int {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return 0
+	}
+
 	return int(C.heif_image_get_height(img.image, uint32(channel)))
 }
 
@@ -93,6 +128,10 @@ func (img *Image) GetHeight(channel Channel) int {
 func (img *Image) GetBitsPerPixel(channel Channel) int {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return 0
+	}
+
 	return int(C.heif_image_get_bits_per_pixel(img.image, uint32(channel)))
 }
 
@@ -103,11 +142,19 @@ func (img *Image) GetBitsPerPixel(channel Channel) int {
 func (img *Image) GetBitsPerPixelRange(channel Channel) int {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return 0
+	}
+
 	return int(C.heif_image_get_bits_per_pixel_range(img.image, uint32(channel)))
 }
 
 // GetImage convers the image to a Go Image object.
 func (img *Image) GetImage() (image.Image, error) {
+	if img.image == nil {
+		return nil, ErrClosed
+	}
+
 	var i image.Image
 	cf := img.GetChromaFormat()
 	switch cs := img.GetColorspace(); cs {
@@ -389,7 +436,7 @@ func (img *Image) GetImage() (image.Image, error) {
 			}
 			i = &image.RGBA64{
 				Pix:    rgba,
-				Stride: width * 4,
+				Stride: width * 8,
 				Rect: image.Rectangle{
 					Min: image.Point{
 						X: 0,
@@ -457,6 +504,54 @@ func (img *Image) GetImage() (image.Image, error) {
 		default:
 			return nil, fmt.Errorf("Unsupported RGB chroma format: %v", cf)
 		}
+	case ColorspaceMonochrome:
+		if cf != ChromaMonochrome {
+			return nil, fmt.Errorf("Unsupported monochrome chroma format: %v", cf)
+		}
+		y, err := img.GetPlane(ChannelY)
+		if err != nil {
+			return nil, err
+		}
+		width := img.GetWidth(ChannelY)
+		height := img.GetHeight(ChannelY)
+		rect := image.Rectangle{
+			Min: image.Point{
+				X: 0,
+				Y: 0,
+			},
+			Max: image.Point{
+				X: width,
+				Y: height,
+			},
+		}
+		if bpp := img.GetBitsPerPixelRange(ChannelY); bpp > 8 {
+			gray := make([]byte, width*height*2)
+			read_pos := 0
+			write_pos := 0
+			stride_add := y.Stride - width*2
+			for row := 0; row < height; row++ {
+				for x := 0; x < width; x++ {
+					value := (uint16(y.Plane[read_pos+1]) << 8) | uint16(y.Plane[read_pos])
+					value = (value << (16 - uint(bpp))) | (value >> (2*uint(bpp) - 16))
+					gray[write_pos] = byte(value >> 8)
+					gray[write_pos+1] = byte(value & 0xff)
+					read_pos += 2
+					write_pos += 2
+				}
+				read_pos += stride_add
+			}
+			i = &image.Gray16{
+				Pix:    gray,
+				Stride: width * 2,
+				Rect:   rect,
+			}
+		} else {
+			i = &image.Gray{
+				Pix:    y.Plane,
+				Stride: y.Stride,
+				Rect:   rect,
+			}
+		}
 	default:
 		return nil, fmt.Errorf("Unsupported colorspace: %v", cs)
 	}
@@ -469,6 +564,10 @@ func (img *Image) GetImage() (image.Image, error) {
 func (img *Image) GetPlane(channel Channel) (*ImageAccess, error) {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return nil, ErrClosed
+	}
+
 	height := C.heif_image_get_height(img.image, uint32(channel))
 	if height == -1 {
 		return nil, fmt.Errorf("No such channel %v", channel)
@@ -489,6 +588,7 @@ func (img *Image) GetPlane(channel Channel) (*ImageAccess, error) {
 		height:   int(height),
 		image:    img,
 	}
+	img.updateMemoryUsage()
 	return access, nil
 }
 
@@ -497,6 +597,10 @@ func (img *Image) GetPlane(channel Channel) (*ImageAccess, error) {
 func (img *Image) NewPlane(channel Channel, width, height, depth int) (*ImageAccess, error) {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return nil, ErrClosed
+	}
+
 	err := C.heif_image_add_plane(img.image, uint32(channel), C.int(width), C.int(height), C.int(depth))
 	if err := convertHeifError(err); err != nil {
 		return nil, err
@@ -508,12 +612,17 @@ func (img *Image) NewPlane(channel Channel, width, height, depth int) (*ImageAcc
 func (img *Image) ScaleImage(width int, height int) (*Image, error) {
 	defer runtime.KeepAlive(img)
 
+	if img.image == nil {
+		return nil, ErrClosed
+	}
+
 	var scaled_image Image
 	err := C.heif_image_scale_image(img.image, &scaled_image.image, C.int(width), C.int(height), nil)
 	if err := convertHeifError(err); err != nil {
 		return nil, err
 	}
 
+	scaled_image.updateMemoryUsage()
 	runtime.SetFinalizer(&scaled_image, freeHeifImage)
 	return &scaled_image, nil
 }
@@ -23,62 +23,173 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"sync/atomic"
 )
 
 // --- High-level decoding API, always decodes primary image (if present).
 
-func decodePrimaryImageFromReader(r io.Reader) (*ImageHandle, error) {
-	ctx, err := NewContext()
-	if err != nil {
-		return nil, err
+// DecodeOptions contain options for the high-level decoding API.
+type DecodeOptions struct {
+	// Options are passed to libheif when decoding the image. If nil, the
+	// defaults of libheif are used, i.e. transformations are applied, the
+	// decoder with the highest priority is chosen and HDR images are decoded
+	// with their native bit depth.
+	Options *DecodingOptions
+}
+
+func (o *DecodeOptions) decodingOptions() *DecodingOptions {
+	if o == nil {
+		return nil
 	}
 
+	return o.Options
+}
+
+var defaultDecodeOptions atomic.Pointer[DecodeOptions]
+
+// SetDefaultDecodeOptions sets the options that are used when decoding images
+// through the functions registered with the "image" package, i.e.
+// image.Decode. Pass nil to restore the defaults of libheif.
+func SetDefaultDecodeOptions(opts *DecodeOptions) {
+	defaultDecodeOptions.Store(opts)
+}
+
+// GetDefaultDecodeOptions returns the options that are used when decoding
+// images through the functions registered with the "image" package.
+func GetDefaultDecodeOptions() *DecodeOptions {
+	return defaultDecodeOptions.Load()
+}
+
+func decodePrimaryImageFromReader(r io.Reader) (*Context, *ImageHandle, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	ctx, err := NewContext()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if err := ctx.ReadFromMemory(data); err != nil {
-		return nil, err
+		ctx.Close()
+		return nil, nil, err
 	}
 
 	handle, err := ctx.GetPrimaryImageHandle()
 	if err != nil {
-		return nil, err
+		ctx.Close()
+		return nil, nil, err
 	}
 
-	return handle, nil
+	return ctx, handle, nil
 }
 
-func decodeImage(r io.Reader) (image.Image, error) {
-	handle, err := decodePrimaryImageFromReader(r)
+// decodeTarget returns the colorspace and chroma the image of the given handle
+// should be decoded to, together with the color model of the image.Image that
+// GetImage will return for it.
+func decodeTarget(handle *ImageHandle, options *DecodingOptions) (Colorspace, Chroma, color.Model) {
+	hdr := handle.GetLumaBitsPerPixel() > 8 || handle.GetChromaBitsPerPixel() > 8
+	if hdr && options != nil && options.GetConvertHDRTo8Bit() {
+		hdr = false
+	}
+
+	if handle.HasAlphaChannel() {
+		if hdr {
+			return ColorspaceRGB, ChromaInterleavedRRGGBBAA_BE, color.RGBA64Model
+		}
+
+		return ColorspaceRGB, ChromaInterleavedRGBA, color.RGBAModel
+	}
+
+	colorspace, chroma, err := handle.GetPreferredDecodingColorspace()
+	if err != nil {
+		colorspace, chroma = ColorspaceUndefined, ChromaUndefined
+	}
+
+	switch {
+	case colorspace == ColorspaceMonochrome || chroma == ChromaMonochrome:
+		if hdr {
+			return ColorspaceMonochrome, ChromaMonochrome, color.Gray16Model
+		}
+
+		return ColorspaceMonochrome, ChromaMonochrome, color.GrayModel
+	case hdr:
+		return ColorspaceRGB, ChromaInterleavedRRGGBB_BE, color.RGBA64Model
+	case colorspace == ColorspaceYCbCr && (chroma == Chroma420 || chroma == Chroma422 || chroma == Chroma444):
+		return ColorspaceYCbCr, chroma, color.YCbCrModel
+	default:
+		return ColorspaceRGB, ChromaInterleavedRGB, color.RGBAModel
+	}
+}
+
+// Decode reads a HEIF image from r and returns the primary image as an
+// image.Image using the given options. If opts is nil, the defaults of
+// libheif are used.
+func Decode(r io.Reader, opts *DecodeOptions) (image.Image, error) {
+	ctx, handle, err := decodePrimaryImageFromReader(r)
 	if err != nil {
 		return nil, err
 	}
+	defer ctx.Close()
+	defer handle.Close()
+
+	return handle.Decode(opts)
+}
+
+// Decode decodes the image of the handle and returns it as an image.Image
+// using the given options. The type of the returned image depends on the
+// image, see Decode. If opts is nil, the defaults of libheif are used.
+func (h *ImageHandle) Decode(opts *DecodeOptions) (image.Image, error) {
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
 
-	img, err := handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, nil)
+	options := opts.decodingOptions()
+	colorspace, chroma, _ := decodeTarget(h, options)
+	img, err := h.DecodeImage(colorspace, chroma, options)
 	if err != nil {
 		return nil, err
 	}
+	defer img.Close()
 
 	return img.GetImage()
 }
 
-func decodeConfig(r io.Reader) (image.Config, error) {
+// DecodeConfig returns the color model and dimensions of the primary image
+// of a HEIF image without decoding the image data. The color model matches
+// the image returned by Decode when called with the same options.
+func DecodeConfig(r io.Reader, opts *DecodeOptions) (image.Config, error) {
 	var config image.Config
-	handle, err := decodePrimaryImageFromReader(r)
+	ctx, handle, err := decodePrimaryImageFromReader(r)
 	if err != nil {
 		return config, err
 	}
+	defer ctx.Close()
+	defer handle.Close()
 
+	options := opts.decodingOptions()
+	_, _, model := decodeTarget(handle, options)
 	config = image.Config{
-		ColorModel: color.YCbCrModel,
+		ColorModel: model,
 		Width:      handle.GetWidth(),
 		Height:     handle.GetHeight(),
 	}
+	if options != nil && options.GetIgnoreTransformations() {
+		config.Width = handle.GetIspeWidth()
+		config.Height = handle.GetIspeHeight()
+	}
 	return config, nil
 }
 
+func decodeImage(r io.Reader) (image.Image, error) {
+	return Decode(r, GetDefaultDecodeOptions())
+}
+
+func decodeConfig(r io.Reader) (image.Config, error) {
+	return DecodeConfig(r, GetDefaultDecodeOptions())
+}
+
 func init() {
 	image.RegisterFormat("heif", "????ftypheic", decodeImage, decodeConfig)
 	image.RegisterFormat("heif", "????ftypheim", decodeImage, decodeConfig)
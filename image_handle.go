@@ -27,30 +27,64 @@ import "C"
 
 import (
 	"runtime"
+	"time"
 	"unsafe"
 )
 
 // ImageHandle contains information about an image in a libheif Context.
 type ImageHandle struct {
 	handle *C.struct_heif_image_handle
+	ctx    *Context // need this reference to access item properties in the context
 }
 
 func freeHeifImageHandle(c *ImageHandle) {
+	if c.handle == nil {
+		return
+	}
+
 	C.heif_image_handle_release(c.handle)
 	c.handle = nil
 }
 
+// Close releases the image handle immediately instead of waiting for the
+// garbage collector. Images decoded from the handle can still be used
+// afterwards. It is safe to call Close multiple times, other methods fail
+// with ErrClosed or return zero values after the handle has been closed.
+func (h *ImageHandle) Close() {
+	runtime.SetFinalizer(h, nil)
+	freeHeifImageHandle(h)
+}
+
 // IsPrimaryImage checks if the image handle is for a primary image.
 func (h *ImageHandle) IsPrimaryImage() bool {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return false
+	}
+
 	return C.heif_image_handle_is_primary_image(h.handle) != 0
 }
 
+// GetItemID returns the id of the item of the image handle.
+func (h *ImageHandle) GetItemID() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return 0
+	}
+
+	return int(C.heif_image_handle_get_item_id(h.handle))
+}
+
 // GetWidth returns the width of the image handle.
 func (h *ImageHandle) GetWidth() int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return 0
+	}
+
 	return int(C.heif_image_handle_get_width(h.handle))
 }
 
@@ -58,20 +92,112 @@ func (h *ImageHandle) GetWidth() int {
 func (h *ImageHandle) GetHeight() int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return 0
+	}
+
 	return int(C.heif_image_handle_get_height(h.handle))
 }
 
+// GetIspeWidth returns the width of the image handle before any
+// transformations like cropping or rotation are applied.
+func (h *ImageHandle) GetIspeWidth() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return 0
+	}
+
+	return int(C.heif_image_handle_get_ispe_width(h.handle))
+}
+
+// GetIspeHeight returns the height of the image handle before any
+// transformations like cropping or rotation are applied.
+func (h *ImageHandle) GetIspeHeight() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return 0
+	}
+
+	return int(C.heif_image_handle_get_ispe_height(h.handle))
+}
+
 // HasAlphaChannel checks if the image handle has an alpha channel.
 func (h *ImageHandle) HasAlphaChannel() bool {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return false
+	}
+
 	return C.heif_image_handle_has_alpha_channel(h.handle) != 0
 }
 
+// IsPremultipliedAlpha checks if the color values of the image handle are
+// premultiplied with the alpha channel.
+func (h *ImageHandle) IsPremultipliedAlpha() bool {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return false
+	}
+
+	return C.heif_image_handle_is_premultiplied_alpha(h.handle) != 0
+}
+
+// GetLumaBitsPerPixel returns the number of bits used for storage of each
+// luma pixel, or -1 if this is undefined.
+func (h *ImageHandle) GetLumaBitsPerPixel() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return -1
+	}
+
+	return int(C.heif_image_handle_get_luma_bits_per_pixel(h.handle))
+}
+
+// GetChromaBitsPerPixel returns the number of bits used for storage of each
+// chroma pixel, or -1 if this is undefined (e.g. for monochrome images).
+func (h *ImageHandle) GetChromaBitsPerPixel() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return -1
+	}
+
+	return int(C.heif_image_handle_get_chroma_bits_per_pixel(h.handle))
+}
+
+// GetPreferredDecodingColorspace returns the colorspace and chroma that are
+// closest to the way the image is stored, i.e. decoding to them requires no
+// or only minimal conversion.
+func (h *ImageHandle) GetPreferredDecodingColorspace() (Colorspace, Chroma, error) {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return ColorspaceUndefined, ChromaUndefined, ErrClosed
+	}
+
+	var colorspace C.enum_heif_colorspace
+	var chroma C.enum_heif_chroma
+	err := C.heif_image_handle_get_preferred_decoding_colorspace(h.handle, &colorspace, &chroma)
+	if err := convertHeifError(err); err != nil {
+		return ColorspaceUndefined, ChromaUndefined, err
+	}
+
+	return Colorspace(colorspace), Chroma(chroma), nil
+}
+
 // HasDepthImage checks if the image handle has a depth channel.
 func (h *ImageHandle) HasDepthImage() bool {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return false
+	}
+
 	return C.heif_image_handle_has_depth_image(h.handle) != 0
 }
 
@@ -79,6 +205,10 @@ func (h *ImageHandle) HasDepthImage() bool {
 func (h *ImageHandle) GetNumberOfDepthImages() int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return 0
+	}
+
 	return int(C.heif_image_handle_get_number_of_depth_images(h.handle))
 }
 
@@ -86,6 +216,10 @@ func (h *ImageHandle) GetNumberOfDepthImages() int {
 func (h *ImageHandle) GetListOfDepthImageIDs() []int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return []int{}
+	}
+
 	num := int(C.heif_image_handle_get_number_of_depth_images(h.handle))
 	if num == 0 {
 		return []int{}
@@ -100,7 +234,13 @@ func (h *ImageHandle) GetListOfDepthImageIDs() []int {
 func (h *ImageHandle) GetDepthImageHandle(depth_image_id int) (*ImageHandle, error) {
 	defer runtime.KeepAlive(h)
 
-	var handle ImageHandle
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	handle := ImageHandle{
+		ctx: h.ctx,
+	}
 	err := C.heif_image_handle_get_depth_image_handle(h.handle, C.heif_item_id(depth_image_id), &handle.handle)
 	if err := convertHeifError(err); err != nil {
 		return nil, err
@@ -110,10 +250,87 @@ func (h *ImageHandle) GetDepthImageHandle(depth_image_id int) (*ImageHandle, err
 	return &handle, nil
 }
 
+// auxiliaryFilter excludes alpha and depth images which have dedicated accessors.
+const auxiliaryFilter = C.LIBHEIF_AUX_IMAGE_FILTER_OMIT_ALPHA | C.LIBHEIF_AUX_IMAGE_FILTER_OMIT_DEPTH
+
+// GetNumberOfAuxiliaryImages returns the number of auxiliary images other than
+// alpha channels and depth images in the image handle.
+func (h *ImageHandle) GetNumberOfAuxiliaryImages() int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return 0
+	}
+
+	return int(C.heif_image_handle_get_number_of_auxiliary_images(h.handle, auxiliaryFilter))
+}
+
+// GetListOfAuxiliaryImageIDs returns the list of auxiliary image ids other
+// than alpha channels and depth images in the image handle.
+func (h *ImageHandle) GetListOfAuxiliaryImageIDs() []int {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return []int{}
+	}
+
+	num := int(C.heif_image_handle_get_number_of_auxiliary_images(h.handle, auxiliaryFilter))
+	if num == 0 {
+		return []int{}
+	}
+
+	origIDs := make([]C.heif_item_id, num)
+	num = int(C.heif_image_handle_get_list_of_auxiliary_image_IDs(h.handle, auxiliaryFilter, &origIDs[0], C.int(num)))
+	return convertItemIDs(origIDs, num)
+}
+
+// GetAuxiliaryImageHandle returns the image handle for the given auxiliary image id.
+func (h *ImageHandle) GetAuxiliaryImageHandle(auxiliary_id int) (*ImageHandle, error) {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	handle := ImageHandle{
+		ctx: h.ctx,
+	}
+	err := C.heif_image_handle_get_auxiliary_image_handle(h.handle, C.heif_item_id(auxiliary_id), &handle.handle)
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+
+	runtime.SetFinalizer(&handle, freeHeifImageHandle)
+	return &handle, nil
+}
+
+// GetAuxiliaryType returns the type URN of an auxiliary image handle, e.g.
+// "urn:com:apple:photo:2020:aux:hdrgainmap".
+func (h *ImageHandle) GetAuxiliaryType() (string, error) {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return "", ErrClosed
+	}
+
+	var t *C.char
+	err := C.heif_image_handle_get_auxiliary_type(h.handle, &t)
+	if err := convertHeifError(err); err != nil {
+		return "", err
+	}
+	defer C.heif_image_handle_release_auxiliary_type(h.handle, &t)
+
+	return C.GoString(t), nil
+}
+
 // GetNumberOfThumbnails returns the number of thumbnails in the image handle.
 func (h *ImageHandle) GetNumberOfThumbnails() int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return 0
+	}
+
 	return int(C.heif_image_handle_get_number_of_thumbnails(h.handle))
 }
 
@@ -121,6 +338,10 @@ func (h *ImageHandle) GetNumberOfThumbnails() int {
 func (h *ImageHandle) GetListOfThumbnailIDs() []int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return []int{}
+	}
+
 	num := int(C.heif_image_handle_get_number_of_thumbnails(h.handle))
 	if num == 0 {
 		return []int{}
@@ -135,7 +356,13 @@ func (h *ImageHandle) GetListOfThumbnailIDs() []int {
 func (h *ImageHandle) GetThumbnail(thumbnail_id int) (*ImageHandle, error) {
 	defer runtime.KeepAlive(h)
 
-	var handle ImageHandle
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	handle := ImageHandle{
+		ctx: h.ctx,
+	}
 	err := C.heif_image_handle_get_thumbnail(h.handle, C.heif_item_id(thumbnail_id), &handle.handle)
 	runtime.SetFinalizer(&handle, freeHeifImageHandle)
 	return &handle, convertHeifError(err)
@@ -143,20 +370,58 @@ func (h *ImageHandle) GetThumbnail(thumbnail_id int) (*ImageHandle, error) {
 
 // DecodeImage decodes the image to the provided colorspace and chroma.
 func (h *ImageHandle) DecodeImage(colorspace Colorspace, chroma Chroma, options *DecodingOptions) (*Image, error) {
+	start := time.Now()
+	img, err := h.decodeImage(colorspace, chroma, options)
+	observe(start, func() Event {
+		event := Event{
+			Operation: OperationDecode,
+			Width:     h.GetWidth(),
+			Height:    h.GetHeight(),
+			Err:       err,
+		}
+		if h.ctx != nil {
+			event.Compression = h.ctx.compression
+		}
+		if img != nil {
+			event.Bytes = img.memory
+		}
+		return event
+	})
+	return img, err
+}
+
+func (h *ImageHandle) decodeImage(colorspace Colorspace, chroma Chroma, options *DecodingOptions) (*Image, error) {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
 	var image Image
 
 	var opt *C.struct_heif_decoding_options
 	if options != nil {
+		if options.options == nil {
+			return nil, ErrClosed
+		}
 		opt = options.options
 	}
 
+	// Reserve the memory before decoding, so concurrent decodes can't exceed
+	// the limit. The estimate is replaced by the actual size afterwards.
+	estimate := estimateDecodedSize(h, colorspace, chroma)
+	if err := reserveNativeMemory(estimate); err != nil {
+		return nil, err
+	}
+
 	err := C.heif_decode_image(h.handle, &image.image, uint32(colorspace), uint32(chroma), opt)
 	if err := convertHeifError(err); err != nil {
+		nativeMemoryInUse.Add(-estimate)
 		return nil, err
 	}
 
+	image.memory = estimate
+	image.updateMemoryUsage()
 	runtime.SetFinalizer(&image, freeHeifImage)
 	return &image, nil
 }
@@ -164,6 +429,10 @@ func (h *ImageHandle) DecodeImage(colorspace Colorspace, chroma Chroma, options
 func (h *ImageHandle) GetMetadataBlockIDs(filter string) []int {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return []int{}
+	}
+
 	var f *C.char
 	if filter != "" {
 		f = C.CString(filter)
@@ -182,6 +451,10 @@ func (h *ImageHandle) GetMetadataBlockIDs(filter string) []int {
 func (h *ImageHandle) GetMetadataContentType(block_id int) string {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return ""
+	}
+
 	ct := C.heif_image_handle_get_metadata_content_type(h.handle, C.heif_item_id(block_id))
 	if ct == nil {
 		return ""
@@ -190,9 +463,47 @@ func (h *ImageHandle) GetMetadataContentType(block_id int) string {
 	return C.GoString(ct)
 }
 
+// GetMetadataItemType returns the item type of the metadata block, e.g.
+// "Exif", "mime" or "uri ".
+func (h *ImageHandle) GetMetadataItemType(block_id int) string {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return ""
+	}
+
+	t := C.heif_image_handle_get_metadata_type(h.handle, C.heif_item_id(block_id))
+	if t == nil {
+		return ""
+	}
+
+	return C.GoString(t)
+}
+
+// GetMetadataItemURIType returns the URI of metadata blocks with item type
+// "uri " or an empty string for other item types.
+func (h *ImageHandle) GetMetadataItemURIType(block_id int) string {
+	defer runtime.KeepAlive(h)
+
+	if h.handle == nil {
+		return ""
+	}
+
+	uri := C.heif_image_handle_get_metadata_item_uri_type(h.handle, C.heif_item_id(block_id))
+	if uri == nil {
+		return ""
+	}
+
+	return C.GoString(uri)
+}
+
 func (h *ImageHandle) GetMetadata(block_id int) ([]byte, error) {
 	defer runtime.KeepAlive(h)
 
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
 	var err C.struct_heif_error
 	var result []byte
 	if size := C.heif_image_handle_get_metadata_size(h.handle, C.heif_item_id(block_id)); size > 0 {
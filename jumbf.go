@@ -0,0 +1,415 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// C2PAContentType is the content type of metadata blocks containing a C2PA
+// manifest store.
+const C2PAContentType = "application/c2pa"
+
+const (
+	jumbfSuperboxType    = "jumb"
+	jumbfDescriptionType = "jumd"
+
+	jumbfBoxHeaderSize   = 8
+	jumbfLargeHeaderSize = 16
+	jumbfUUIDSize        = 16
+	jumbfSignatureSize   = 32
+	jumbfMaxDepth        = 32
+)
+
+// Toggles of the JUMBF description box.
+const (
+	jumbfToggleRequestable = 0x01
+	jumbfToggleLabel       = 0x02
+	jumbfToggleID          = 0x04
+	jumbfToggleSignature   = 0x08
+	jumbfTogglePrivate     = 0x10
+)
+
+// JUMBFUUID is the content type of a JUMBF superbox.
+type JUMBFUUID [jumbfUUIDSize]byte
+
+// Content types of superboxes defined by C2PA.
+var (
+	// JUMBFTypeC2PA is the content type of a C2PA manifest store.
+	JUMBFTypeC2PA = JUMBFUUID{0x63, 0x32, 0x70, 0x61, 0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+	// JUMBFTypeC2PAManifest is the content type of a C2PA manifest.
+	JUMBFTypeC2PAManifest = JUMBFUUID{0x63, 0x32, 0x6d, 0x61, 0x00, 0x11, 0x00, 0x10, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+)
+
+// JUMBFDescription contains the information of a JUMBF description box.
+type JUMBFDescription struct {
+	// Type is the content type of the superbox.
+	Type JUMBFUUID
+	// Requestable is set if the superbox can be referenced by its label.
+	Requestable bool
+	// Label is the optional label of the superbox.
+	Label string
+	// ID is the optional numeric id of the superbox.
+	ID *uint32
+	// Signature is the optional SHA-256 hash of the superbox contents.
+	Signature []byte
+	// Private is an optional application specific box.
+	Private *JUMBFBox
+}
+
+// JUMBFBox is a box of a JUMBF hierarchy. Superboxes (type "jumb") have a
+// description and child boxes, all other boxes contain their payload.
+type JUMBFBox struct {
+	// Type is the four character type of the box.
+	Type string
+	// Description is the description of a superbox.
+	Description *JUMBFDescription
+	// Boxes are the child boxes of a superbox.
+	Boxes []*JUMBFBox
+	// Payload is the content of a box that is not a superbox.
+	Payload []byte
+}
+
+// IsSuperbox returns true if the box contains other boxes.
+func (b *JUMBFBox) IsSuperbox() bool {
+	return b.Type == jumbfSuperboxType
+}
+
+// Label returns the label of a superbox or an empty string.
+func (b *JUMBFBox) Label() string {
+	if b.Description == nil {
+		return ""
+	}
+
+	return b.Description.Label
+}
+
+// Find returns the first child superbox with the given label or nil.
+func (b *JUMBFBox) Find(label string) *JUMBFBox {
+	for _, child := range b.Boxes {
+		if child.IsSuperbox() && child.Label() == label {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// IsC2PA returns true if the box is a C2PA manifest store.
+func (b *JUMBFBox) IsC2PA() bool {
+	return b.Description != nil && b.Description.Type == JUMBFTypeC2PA
+}
+
+// C2PAManifests returns the manifests of a C2PA manifest store.
+func (b *JUMBFBox) C2PAManifests() []*JUMBFBox {
+	var result []*JUMBFBox
+	for _, child := range b.Boxes {
+		if child.Description != nil && child.Description.Type == JUMBFTypeC2PAManifest {
+			result = append(result, child)
+		}
+	}
+
+	return result
+}
+
+func readJUMBFBoxHeader(data []byte) (string, []byte, []byte, error) {
+	if len(data) < jumbfBoxHeaderSize {
+		return "", nil, nil, errors.New("JUMBF box header too short")
+	}
+
+	size := uint64(binary.BigEndian.Uint32(data))
+	typ := string(data[4:8])
+	headerSize := uint64(jumbfBoxHeaderSize)
+	switch size {
+	case 0:
+		// Box extends to the end of the data.
+		size = uint64(len(data))
+	case 1:
+		if len(data) < jumbfLargeHeaderSize {
+			return "", nil, nil, errors.New("JUMBF box header too short")
+		}
+
+		size = binary.BigEndian.Uint64(data[8:])
+		headerSize = jumbfLargeHeaderSize
+	}
+	if size < headerSize || size > uint64(len(data)) {
+		return "", nil, nil, fmt.Errorf("invalid size %d of JUMBF box %q", size, typ)
+	}
+
+	return typ, data[headerSize:size], data[size:], nil
+}
+
+func parseJUMBFDescription(data []byte, depth int) (*JUMBFDescription, error) {
+	if len(data) < jumbfUUIDSize+1 {
+		return nil, errors.New("JUMBF description too short")
+	}
+
+	d := &JUMBFDescription{}
+	copy(d.Type[:], data)
+	toggles := data[jumbfUUIDSize]
+	data = data[jumbfUUIDSize+1:]
+	d.Requestable = toggles&jumbfToggleRequestable != 0
+	if toggles&jumbfToggleLabel != 0 {
+		pos := bytes.IndexByte(data, 0)
+		if pos == -1 {
+			return nil, errors.New("unterminated JUMBF label")
+		}
+
+		d.Label = string(data[:pos])
+		data = data[pos+1:]
+	}
+	if toggles&jumbfToggleID != 0 {
+		if len(data) < 4 {
+			return nil, errors.New("JUMBF description id too short")
+		}
+
+		id := binary.BigEndian.Uint32(data)
+		d.ID = &id
+		data = data[4:]
+	}
+	if toggles&jumbfToggleSignature != 0 {
+		if len(data) < jumbfSignatureSize {
+			return nil, errors.New("JUMBF description signature too short")
+		}
+
+		d.Signature = bytes.Clone(data[:jumbfSignatureSize])
+		data = data[jumbfSignatureSize:]
+	}
+	if toggles&jumbfTogglePrivate != 0 {
+		boxes, err := parseJUMBFBoxes(data, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(boxes) != 1 {
+			return nil, fmt.Errorf("expected one private JUMBF box, got %d", len(boxes))
+		}
+
+		d.Private = boxes[0]
+	}
+
+	return d, nil
+}
+
+func parseJUMBFBoxes(data []byte, depth int) ([]*JUMBFBox, error) {
+	if depth > jumbfMaxDepth {
+		return nil, errors.New("JUMBF boxes nested too deep")
+	}
+
+	var result []*JUMBFBox
+	for len(data) > 0 {
+		typ, payload, rest, err := readJUMBFBoxHeader(data)
+		if err != nil {
+			return nil, err
+		}
+
+		box := &JUMBFBox{
+			Type: typ,
+		}
+		if box.IsSuperbox() {
+			descType, description, children, err := readJUMBFBoxHeader(payload)
+			if err != nil {
+				return nil, err
+			}
+			if descType != jumbfDescriptionType {
+				return nil, fmt.Errorf("expected JUMBF description box, got %q", descType)
+			}
+
+			if box.Description, err = parseJUMBFDescription(description, depth); err != nil {
+				return nil, err
+			}
+			if box.Boxes, err = parseJUMBFBoxes(children, depth+1); err != nil {
+				return nil, err
+			}
+		} else {
+			box.Payload = bytes.Clone(payload)
+		}
+
+		result = append(result, box)
+		data = rest
+	}
+
+	return result, nil
+}
+
+// ParseJUMBF parses a sequence of JUMBF superboxes.
+func ParseJUMBF(data []byte) ([]*JUMBFBox, error) {
+	boxes, err := parseJUMBFBoxes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(boxes) == 0 {
+		return nil, errors.New("no JUMBF boxes found")
+	}
+	for _, box := range boxes {
+		if !box.IsSuperbox() {
+			return nil, fmt.Errorf("expected JUMBF superbox, got %q", box.Type)
+		}
+	}
+
+	return boxes, nil
+}
+
+func isJUMBF(data []byte) bool {
+	return len(data) >= jumbfBoxHeaderSize && string(data[4:8]) == jumbfSuperboxType
+}
+
+func appendJUMBFBox(data []byte, typ string, payload []byte) ([]byte, error) {
+	if len(typ) != 4 {
+		return nil, fmt.Errorf("invalid JUMBF box type %q", typ)
+	}
+
+	if size := uint64(len(payload)) + jumbfBoxHeaderSize; size <= math.MaxUint32 {
+		data = binary.BigEndian.AppendUint32(data, uint32(size))
+		data = append(data, typ...)
+	} else {
+		data = binary.BigEndian.AppendUint32(data, 1)
+		data = append(data, typ...)
+		data = binary.BigEndian.AppendUint64(data, size+jumbfLargeHeaderSize-jumbfBoxHeaderSize)
+	}
+	return append(data, payload...), nil
+}
+
+func (d *JUMBFDescription) bytes() ([]byte, error) {
+	var toggles byte
+	if d.Requestable {
+		toggles |= jumbfToggleRequestable
+	}
+	if d.Label != "" {
+		toggles |= jumbfToggleLabel
+	}
+	if d.ID != nil {
+		toggles |= jumbfToggleID
+	}
+	if d.Signature != nil {
+		if len(d.Signature) != jumbfSignatureSize {
+			return nil, fmt.Errorf("JUMBF signature must be %d bytes", jumbfSignatureSize)
+		}
+
+		toggles |= jumbfToggleSignature
+	}
+	if d.Private != nil {
+		toggles |= jumbfTogglePrivate
+	}
+
+	data := make([]byte, 0, jumbfUUIDSize+1+len(d.Label)+1)
+	data = append(data, d.Type[:]...)
+	data = append(data, toggles)
+	if d.Label != "" {
+		if bytes.IndexByte([]byte(d.Label), 0) != -1 {
+			return nil, errors.New("JUMBF label may not contain null bytes")
+		}
+
+		data = append(data, d.Label...)
+		data = append(data, 0)
+	}
+	if d.ID != nil {
+		data = binary.BigEndian.AppendUint32(data, *d.ID)
+	}
+	data = append(data, d.Signature...)
+	if d.Private != nil {
+		private, err := d.Private.Bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, private...)
+	}
+	return data, nil
+}
+
+// Bytes serializes the box and all its children.
+func (b *JUMBFBox) Bytes() ([]byte, error) {
+	if !b.IsSuperbox() {
+		return appendJUMBFBox(nil, b.Type, b.Payload)
+	}
+
+	if b.Description == nil {
+		return nil, errors.New("JUMBF superbox has no description")
+	}
+
+	description, err := b.Description.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := appendJUMBFBox(nil, jumbfDescriptionType, description)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range b.Boxes {
+		data, err := child.Bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		payload = append(payload, data...)
+	}
+	return appendJUMBFBox(nil, b.Type, payload)
+}
+
+// GetJUMBFManifests returns the JUMBF superboxes of all metadata blocks of
+// the image that contain JUMBF data, e.g. C2PA manifest stores. Signatures
+// are not validated.
+func (h *ImageHandle) GetJUMBFManifests() ([]*JUMBFBox, error) {
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	var result []*JUMBFBox
+	for _, id := range h.GetMetadataBlockIDs("") {
+		if h.GetMetadataItemType(id) == "Exif" {
+			continue
+		}
+
+		data, err := h.GetMetadata(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isJUMBF(data) {
+			continue
+		}
+
+		boxes, err := ParseJUMBF(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JUMBF data in metadata block %d: %w", id, err)
+		}
+
+		result = append(result, boxes...)
+	}
+
+	return result, nil
+}
+
+// AddJUMBFManifest adds a serialized JUMBF manifest store to the image. The
+// data is embedded unmodified so existing signatures stay valid.
+func (c *Context) AddJUMBFManifest(handle *ImageHandle, data []byte) error {
+	if _, err := ParseJUMBF(data); err != nil {
+		return err
+	}
+
+	return c.AddGenericMetadata(handle, data, "mime", C2PAContentType)
+}
@@ -0,0 +1,163 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManifestStore() *JUMBFBox {
+	id := uint32(42)
+	return &JUMBFBox{
+		Type: "jumb",
+		Description: &JUMBFDescription{
+			Type:        JUMBFTypeC2PA,
+			Requestable: true,
+			Label:       "c2pa",
+		},
+		Boxes: []*JUMBFBox{
+			{
+				Type: "jumb",
+				Description: &JUMBFDescription{
+					Type:        JUMBFTypeC2PAManifest,
+					Requestable: true,
+					Label:       "urn:uuid:0b5d3c4e-ff4a-4f4e-8a4a-5a6c3e0d1f2a",
+					ID:          &id,
+					Signature:   bytes.Repeat([]byte{0xab}, 32),
+					Private: &JUMBFBox{
+						Type:    "priv",
+						Payload: []byte("private"),
+					},
+				},
+				Boxes: []*JUMBFBox{
+					{
+						Type: "jumb",
+						Description: &JUMBFDescription{
+							Type:  JUMBFUUID{'c', 'b', 'o', 'r'},
+							Label: "c2pa.claim",
+						},
+						Boxes: []*JUMBFBox{
+							{
+								Type:    "cbor",
+								Payload: []byte{0xa1, 0x61, 0x61, 0x01},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestJUMBFRoundtrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := newTestManifestStore()
+	data, err := store.Bytes()
+	require.NoError(err)
+
+	boxes, err := ParseJUMBF(data)
+	require.NoError(err)
+	require.Len(boxes, 1)
+	assert.Equal(store, boxes[0])
+
+	parsed := boxes[0]
+	assert.True(parsed.IsSuperbox())
+	assert.True(parsed.IsC2PA())
+	assert.Equal("c2pa", parsed.Label())
+	if manifests := parsed.C2PAManifests(); assert.Len(manifests, 1) {
+		claim := manifests[0].Find("c2pa.claim")
+		if assert.NotNil(claim) && assert.Len(claim.Boxes, 1) {
+			assert.Equal("cbor", claim.Boxes[0].Type)
+			assert.False(claim.Boxes[0].IsSuperbox())
+		}
+		assert.Nil(manifests[0].Find("c2pa.signature"))
+	}
+
+	data2, err := parsed.Bytes()
+	require.NoError(err)
+	assert.Equal(data, data2)
+
+	// Large box headers and boxes extending to the end are supported.
+	large := []byte{0, 0, 0, 1, 'j', 'u', 'm', 'b', 0, 0, 0, 0, 0, 0, 0, byte(len(data) + 8)}
+	large = append(large, data[8:]...)
+	large = append(large, 0, 0, 0, 0)
+	large = append(large, data[4:]...)
+	boxes, err = ParseJUMBF(large)
+	require.NoError(err)
+	if assert.Len(boxes, 2) {
+		assert.Equal(store, boxes[0])
+		assert.Equal(store, boxes[1])
+	}
+}
+
+func TestJUMBFInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := newTestManifestStore().Bytes()
+	require.NoError(t, err)
+
+	for _, invalid := range [][]byte{
+		nil,
+		data[:7],
+		data[:len(data)-1],
+		{0, 0, 0, 12, 'j', 's', 'o', 'n', '{', '}', ' ', ' '},
+		{0, 0, 0, 16, 'j', 'u', 'm', 'b', 0, 0, 0, 8, 'j', 's', 'o', 'n'},
+		{0, 0, 0, 4, 'j', 'u', 'm', 'b'},
+	} {
+		_, err := ParseJUMBF(invalid)
+		assert.Error(err, "%x", invalid)
+	}
+
+	box := &JUMBFBox{Type: "jumb"}
+	_, err = box.Bytes()
+	assert.Error(err)
+	box.Description = &JUMBFDescription{Signature: []byte{1}}
+	_, err = box.Bytes()
+	assert.Error(err)
+	box.Description = &JUMBFDescription{Label: "a\x00b"}
+	_, err = box.Bytes()
+	assert.Error(err)
+}
+
+func TestEncodeJUMBF(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	store := newTestManifestStore()
+	data, err := store.Bytes()
+	require.NoError(err)
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	ctx, handle, err := EncodeFromImage(img, CompressionHEVC, SetEncoderQuality(50))
+	require.NoError(err)
+	assert.Error(ctx.AddJUMBFManifest(handle, []byte("invalid")))
+	require.NoError(ctx.AddJUMBFManifest(handle, data))
+
+	handle = reloadPrimaryImage(t, ctx)
+	if manifests, err := handle.GetJUMBFManifests(); assert.NoError(err) && assert.Len(manifests, 1) {
+		assert.Equal(store, manifests[0])
+	}
+}
@@ -0,0 +1,192 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+var (
+	nativeMemoryInUse atomic.Int64
+	nativeMemoryLimit atomic.Int64
+)
+
+// imageChannels are the channels that can hold pixel data of an image.
+var imageChannels = []Channel{
+	ChannelY,
+	ChannelCb,
+	ChannelCr,
+	ChannelR,
+	ChannelG,
+	ChannelB,
+	ChannelAlpha,
+	ChannelInterleaved,
+}
+
+// NativeMemoryLimitError is returned when decoding an image would exceed the
+// limit set with SetNativeMemoryLimit.
+type NativeMemoryLimitError struct {
+	// Limit is the configured limit in bytes.
+	Limit int64
+	// InUse is the number of bytes that were in use when decoding.
+	InUse int64
+	// Requested is the estimated number of bytes of the decoded image.
+	Requested int64
+}
+
+// Error returns the human readable error message.
+func (e *NativeMemoryLimitError) Error() string {
+	return fmt.Sprintf("decoding %d bytes would exceed native memory limit of %d bytes (%d in use)", e.Requested, e.Limit, e.InUse)
+}
+
+// NativeMemoryInUse returns the number of bytes of pixel data held by images
+// that have not been closed or garbage collected yet. The memory is
+// allocated by libheif and not included in runtime.MemStats.
+func NativeMemoryInUse() int64 {
+	return nativeMemoryInUse.Load()
+}
+
+type nativeMemoryVar struct{}
+
+func (nativeMemoryVar) String() string {
+	return strconv.FormatInt(NativeMemoryInUse(), 10)
+}
+
+// NativeMemoryVar returns a variable that reports NativeMemoryInUse. It
+// implements expvar.Var and can be published with
+//
+//	expvar.Publish("libheif_memory", libheif.NativeMemoryVar())
+//
+// The package doesn't publish it itself, as importing expvar registers a
+// handler with http.DefaultServeMux.
+func NativeMemoryVar() fmt.Stringer {
+	return nativeMemoryVar{}
+}
+
+// SetNativeMemoryLimit sets the maximum number of bytes that images may hold,
+// see NativeMemoryInUse. Decoding an image fails with a NativeMemoryLimitError
+// if its estimated size would exceed the limit. Images created otherwise are
+// accounted but not limited. Pass 0 to remove the limit.
+func SetNativeMemoryLimit(limit int64) {
+	nativeMemoryLimit.Store(max(limit, 0))
+}
+
+// GetNativeMemoryLimit returns the maximum number of bytes that images may
+// hold, or 0 if there is no limit.
+func GetNativeMemoryLimit() int64 {
+	return nativeMemoryLimit.Load()
+}
+
+// reserveNativeMemory accounts size bytes as being in use unless this would
+// exceed the limit.
+func reserveNativeMemory(size int64) error {
+	for {
+		limit := nativeMemoryLimit.Load()
+		inUse := nativeMemoryInUse.Load()
+		if limit > 0 && inUse+size > limit {
+			return &NativeMemoryLimitError{
+				Limit:     limit,
+				InUse:     inUse,
+				Requested: size,
+			}
+		}
+
+		if nativeMemoryInUse.CompareAndSwap(inUse, inUse+size) {
+			return nil
+		}
+	}
+}
+
+// estimateDecodedSize returns the approximate number of bytes of pixel data
+// after decoding the image to the given colorspace and chroma.
+func estimateDecodedSize(h *ImageHandle, colorspace Colorspace, chroma Chroma) int64 {
+	bytesPerSample := int64(1)
+	if h.GetLumaBitsPerPixel() > 8 || h.GetChromaBitsPerPixel() > 8 {
+		bytesPerSample = 2
+	}
+
+	// Samples per pixel multiplied by 4 to handle subsampled chroma.
+	var samples int64
+	switch chroma {
+	case ChromaMonochrome:
+		samples = 4
+	case Chroma420:
+		samples = 6
+	case Chroma422:
+		samples = 8
+	case ChromaInterleavedRGBA:
+		samples = 16
+		bytesPerSample = 1
+	case ChromaInterleavedRGB:
+		samples = 12
+		bytesPerSample = 1
+	case ChromaInterleavedRRGGBBAA_BE, ChromaInterleavedRRGGBBAA_LE:
+		samples = 16
+		bytesPerSample = 2
+	case ChromaInterleavedRRGGBB_BE, ChromaInterleavedRRGGBB_LE:
+		samples = 12
+		bytesPerSample = 2
+	default:
+		samples = 12
+	}
+	if h.HasAlphaChannel() && chroma != ChromaInterleavedRGBA && chroma != ChromaInterleavedRRGGBBAA_BE && chroma != ChromaInterleavedRRGGBBAA_LE {
+		samples += 4
+	}
+	if colorspace == ColorspaceMonochrome {
+		samples = min(samples, 8)
+	}
+
+	pixels := int64(h.GetIspeWidth()) * int64(h.GetIspeHeight())
+	return pixels * samples * bytesPerSample / 4
+}
+
+// updateMemoryUsage updates the number of bytes accounted for the planes of
+// the image.
+func (img *Image) updateMemoryUsage() {
+	defer runtime.KeepAlive(img)
+
+	var size int64
+	for _, channel := range imageChannels {
+		if C.heif_image_has_channel(img.image, uint32(channel)) == 0 {
+			continue
+		}
+
+		var stride C.int
+		if C.heif_image_get_plane_readonly(img.image, uint32(channel), &stride) == nil {
+			continue
+		}
+
+		if height := C.heif_image_get_height(img.image, uint32(channel)); height > 0 {
+			size += int64(stride) * int64(height)
+		}
+	}
+
+	nativeMemoryInUse.Add(size - img.memory)
+	img.memory = size
+}
@@ -0,0 +1,94 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveNativeMemory(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	inUse := NativeMemoryInUse()
+	require.NoError(reserveNativeMemory(100))
+	defer nativeMemoryInUse.Add(-100)
+	assert.GreaterOrEqual(NativeMemoryInUse(), inUse+100)
+
+	SetNativeMemoryLimit(1)
+	defer SetNativeMemoryLimit(0)
+	assert.EqualValues(1, GetNativeMemoryLimit())
+
+	err := reserveNativeMemory(10)
+	var limitErr *NativeMemoryLimitError
+	if assert.True(errors.As(err, &limitErr)) {
+		assert.EqualValues(1, limitErr.Limit)
+		assert.EqualValues(10, limitErr.Requested)
+		assert.GreaterOrEqual(limitErr.InUse, int64(100))
+	}
+
+	SetNativeMemoryLimit(-1)
+	assert.EqualValues(0, GetNativeMemoryLimit())
+	assert.NoError(reserveNativeMemory(10))
+	nativeMemoryInUse.Add(-10)
+
+	value, err := strconv.ParseInt(NativeMemoryVar().String(), 10, 64)
+	assert.NoError(err)
+	assert.Positive(value)
+}
+
+func TestNativeMemoryLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, err := NewContext()
+	require.NoError(err, "Can't create context")
+	defer ctx.Close()
+
+	filename := path.Join("testdata", "example.heic")
+	require.NoError(ctx.ReadFromFile(filename))
+	handle, err := ctx.GetPrimaryImageHandle()
+	require.NoError(err)
+	defer handle.Close()
+
+	img, err := handle.DecodeImage(ColorspaceRGB, ChromaInterleavedRGB, nil)
+	require.NoError(err)
+	size := img.memory
+	assert.GreaterOrEqual(size, int64(handle.GetWidth()*handle.GetHeight()*3))
+	assert.GreaterOrEqual(NativeMemoryInUse(), size)
+
+	SetNativeMemoryLimit(NativeMemoryInUse() + size/2)
+	defer SetNativeMemoryLimit(0)
+	_, err = handle.DecodeImage(ColorspaceRGB, ChromaInterleavedRGB, nil)
+	var limitErr *NativeMemoryLimitError
+	assert.True(errors.As(err, &limitErr), "expected limit error, got %v", err)
+
+	// Closing the image releases its memory and allows decoding again.
+	img.Close()
+	assert.EqualValues(0, img.memory)
+	img, err = handle.DecodeImage(ColorspaceRGB, ChromaInterleavedRGB, nil)
+	require.NoError(err)
+	img.Close()
+}
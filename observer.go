@@ -0,0 +1,219 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Operation is an operation that is reported to an Observer.
+type Operation int
+
+const (
+	// OperationRead is reported by Context.ReadFromMemory and
+	// Context.ReadFromFile.
+	OperationRead Operation = iota
+	// OperationDecode is reported by ImageHandle.DecodeImage.
+	OperationDecode
+	// OperationEncode is reported by EncodeFromImage and
+	// EncodeFromImageWithOptions.
+	OperationEncode
+	// OperationWrite is reported by Context.Write.
+	OperationWrite
+)
+
+// String returns the name of the operation.
+func (o Operation) String() string {
+	switch o {
+	case OperationRead:
+		return "read"
+	case OperationDecode:
+		return "decode"
+	case OperationEncode:
+		return "encode"
+	case OperationWrite:
+		return "write"
+	default:
+		return fmt.Sprintf("Operation(%d)", int(o))
+	}
+}
+
+// Event contains information about a finished operation.
+type Event struct {
+	Operation Operation
+	// Compression is the compression format of the image, or
+	// CompressionUndefined if it is not known.
+	Compression CompressionFormat
+	Duration    time.Duration
+	// Bytes is the size of the data that was read or written, or the size
+	// of the decoded pixel data. It is not set for encodes.
+	Bytes int64
+	// Width and Height are the dimensions of the decoded or encoded image.
+	// They are not set for reads and writes.
+	Width  int
+	Height int
+	// Err is the error of the operation, or nil if it succeeded.
+	Err error
+	// Code is the code of the HeifError of the operation, ErrorOK if it
+	// succeeded. Errors that don't come from libheif are reported as
+	// ErrorUsage, or ErrorMemoryAllocation for a NativeMemoryLimitError.
+	Code ErrorCode
+}
+
+// Observer receives events about finished operations, e.g. to record metrics.
+// It is called synchronously from the goroutine that ran the operation, so
+// it should return quickly and must be safe for concurrent use.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc is an adapter to use a function as Observer.
+type ObserverFunc func(event Event)
+
+// Observe calls f(event).
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+var observer atomic.Pointer[Observer]
+
+// SetObserver sets the observer that is notified about finished operations.
+// Pass nil to remove the observer.
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+
+	observer.Store(&o)
+}
+
+// GetObserver returns the observer that is notified about finished
+// operations, or nil if none is set.
+func GetObserver() Observer {
+	o := observer.Load()
+	if o == nil {
+		return nil
+	}
+
+	return *o
+}
+
+func errorCode(err error) ErrorCode {
+	if err == nil {
+		return ErrorOK
+	}
+
+	var heifErr *HeifError
+	var limitErr *NativeMemoryLimitError
+	switch {
+	case errors.As(err, &heifErr):
+		return heifErr.Code
+	case errors.As(err, &limitErr):
+		return ErrorMemoryAllocation
+	default:
+		return ErrorUsage
+	}
+}
+
+// observe reports the event returned by fn to the observer. The function is
+// only called if an observer is set, the duration and error code are filled
+// in automatically.
+func observe(start time.Time, fn func() Event) {
+	o := GetObserver()
+	if o == nil {
+		return
+	}
+
+	duration := time.Since(start)
+	event := fn()
+	event.Duration = duration
+	event.Code = errorCode(event.Err)
+	o.Observe(event)
+}
+
+// String returns the name of the compression format.
+func (c CompressionFormat) String() string {
+	switch c {
+	case CompressionUndefined:
+		return "undefined"
+	case CompressionHEVC:
+		return "hevc"
+	case CompressionAVC:
+		return "avc"
+	case CompressionJPEG:
+		return "jpeg"
+	case CompressionAV1:
+		return "av1"
+	case CompressionVVC:
+		return "vvc"
+	case CompressionEVC:
+		return "evc"
+	case CompressionJPEG2000:
+		return "jpeg2000"
+	case CompressionUncompressed:
+		return "uncompressed"
+	default:
+		return fmt.Sprintf("CompressionFormat(%d)", int(c))
+	}
+}
+
+// brandCompressions maps brands to the compression format they require.
+var brandCompressions = map[string]CompressionFormat{
+	"heic": CompressionHEVC,
+	"heix": CompressionHEVC,
+	"heim": CompressionHEVC,
+	"heis": CompressionHEVC,
+	"hevc": CompressionHEVC,
+	"hevx": CompressionHEVC,
+	"hevm": CompressionHEVC,
+	"hevs": CompressionHEVC,
+	"avif": CompressionAV1,
+	"avis": CompressionAV1,
+	"jpeg": CompressionJPEG,
+	"jpgs": CompressionJPEG,
+	"j2ki": CompressionJPEG2000,
+	"j2is": CompressionJPEG2000,
+	"vvic": CompressionVVC,
+	"vvis": CompressionVVC,
+}
+
+// detectCompression returns the compression format of a file based on its
+// main and compatible brands.
+func detectCompression(data []byte) CompressionFormat {
+	if compression, found := brandCompressions[ReadMainBrand(data)]; found {
+		return compression
+	}
+
+	brands, err := ListCompatibleBrands(data)
+	if err != nil {
+		return CompressionUndefined
+	}
+
+	for _, brand := range brands {
+		if compression, found := brandCompressions[brand]; found {
+			return compression
+		}
+	}
+	return CompressionUndefined
+}
@@ -0,0 +1,195 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (o *recordingObserver) Observe(event Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) Events() []Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.events
+}
+
+func TestErrorCode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(ErrorOK, errorCode(nil))
+	assert.Equal(ErrorInvalidInput, errorCode(&HeifError{Code: ErrorInvalidInput}))
+	assert.Equal(ErrorInvalidInput, errorCode(fmt.Errorf("wrapped: %w", &HeifError{Code: ErrorInvalidInput})))
+	assert.Equal(ErrorMemoryAllocation, errorCode(&NativeMemoryLimitError{}))
+	assert.Equal(ErrorUsage, errorCode(ErrClosed))
+	assert.Equal(ErrorUsage, errorCode(errors.New("other error")))
+}
+
+func TestObserve(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(GetObserver())
+	assert.Equal("decode", OperationDecode.String())
+	assert.Equal("Operation(42)", Operation(42).String())
+	assert.Equal("hevc", CompressionHEVC.String())
+	assert.Equal("av1", CompressionAV1.String())
+	assert.Equal("CompressionFormat(42)", CompressionFormat(42).String())
+
+	var o recordingObserver
+	SetObserver(&o)
+	defer SetObserver(nil)
+	assert.Same(&o, GetObserver())
+
+	err := &HeifError{Code: ErrorDecoderPlugin}
+	observe(time.Now(), func() Event {
+		return Event{
+			Operation: OperationDecode,
+			Bytes:     42,
+			Err:       err,
+		}
+	})
+	if events := o.Events(); assert.Len(events, 1) {
+		assert.Equal(OperationDecode, events[0].Operation)
+		assert.EqualValues(42, events[0].Bytes)
+		assert.Equal(ErrorDecoderPlugin, events[0].Code)
+		assert.Positive(events[0].Duration)
+	}
+
+	SetObserver(nil)
+	assert.Nil(GetObserver())
+	observe(time.Now(), func() Event {
+		assert.Fail("should not be called without observer")
+		return Event{}
+	})
+}
+
+func TestObserverEvents(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	filename := path.Join("testdata", "example.heic")
+	data, err := os.ReadFile(filename)
+	require.NoError(err)
+
+	var o recordingObserver
+	SetObserver(&o)
+	defer SetObserver(nil)
+
+	img, err := Decode(bytes.NewReader(data), nil)
+	require.NoError(err)
+
+	ctx, _, err := EncodeFromImage(img, CompressionHEVC)
+	require.NoError(err)
+	defer ctx.Close()
+
+	var buf bytes.Buffer
+	require.NoError(ctx.Write(&buf))
+
+	events := o.Events()
+	require.Len(events, 4)
+	for _, event := range events {
+		assert.Equal(CompressionHEVC, event.Compression, "%s", event.Operation)
+		assert.NoError(event.Err)
+		assert.Equal(ErrorOK, event.Code)
+	}
+
+	assert.Equal(OperationRead, events[0].Operation)
+	assert.EqualValues(len(data), events[0].Bytes)
+	assert.Equal(OperationDecode, events[1].Operation)
+	assert.Equal(img.Bounds().Dx(), events[1].Width)
+	assert.Equal(img.Bounds().Dy(), events[1].Height)
+	assert.Positive(events[1].Bytes)
+	assert.Equal(OperationEncode, events[2].Operation)
+	assert.Equal(img.Bounds().Dx(), events[2].Width)
+	assert.Equal(OperationWrite, events[3].Operation)
+	assert.EqualValues(buf.Len(), events[3].Bytes)
+
+	_, err = Decode(bytes.NewReader([]byte("invalid")), nil)
+	assert.Error(err)
+	events = o.Events()
+	if assert.Len(events, 5) {
+		assert.Equal(OperationRead, events[4].Operation)
+		assert.Equal(errorCode(err), events[4].Code)
+		assert.NotEqual(ErrorOK, events[4].Code)
+	}
+}
+
+func TestObserverReadFromFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	filename := path.Join("testdata", "example.heic")
+
+	assert.Equal(CompressionHEVC, detectFileCompression(filename))
+	assert.Equal(CompressionUndefined, detectFileCompression(path.Join("testdata", "missing.heic")))
+
+	fi, err := os.Stat(filename)
+	require.NoError(err)
+
+	var o recordingObserver
+	SetObserver(&o)
+	defer SetObserver(nil)
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	defer ctx.Close()
+	require.NoError(ctx.ReadFromFile(filename))
+
+	handle, err := ctx.GetPrimaryImageHandle()
+	require.NoError(err)
+	defer handle.Close()
+
+	img, err := handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, nil)
+	require.NoError(err)
+	defer img.Close()
+
+	if events := o.Events(); assert.Len(events, 2) {
+		assert.Equal(OperationRead, events[0].Operation)
+		assert.Equal(CompressionHEVC, events[0].Compression)
+		assert.Equal(fi.Size(), events[0].Bytes)
+		assert.NoError(events[0].Err)
+		assert.Equal(OperationDecode, events[1].Operation)
+		assert.Equal(CompressionHEVC, events[1].Compression)
+	}
+
+	ctx2, err := NewContext()
+	require.NoError(err)
+	defer ctx2.Close()
+	assert.Error(ctx2.ReadFromFile(path.Join("testdata", "missing.heic")))
+	if events := o.Events(); assert.Len(events, 3) {
+		assert.Equal(OperationRead, events[2].Operation)
+		assert.Error(events[2].Err)
+	}
+}
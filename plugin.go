@@ -0,0 +1,175 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+/*
+#cgo pkg-config: libheif
+#include <stdlib.h>
+#include <string.h>
+#include <libheif/heif.h>
+#include <libheif/heif_plugin.h>
+
+static const char* get_plugin_name(const struct heif_plugin_info* info) {
+	switch (info->type) {
+		case heif_plugin_type_encoder:
+			return ((const struct heif_encoder_plugin*) info->plugin)->get_plugin_name();
+		case heif_plugin_type_decoder:
+			return ((const struct heif_decoder_plugin*) info->plugin)->get_plugin_name();
+		default:
+			return NULL;
+	}
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+)
+
+// PluginType is the type of a codec plugin.
+type PluginType C.enum_heif_plugin_type
+
+const (
+	// PluginTypeEncoder is a plugin that provides an encoder.
+	PluginTypeEncoder PluginType = C.heif_plugin_type_encoder
+	// PluginTypeDecoder is a plugin that provides a decoder.
+	PluginTypeDecoder PluginType = C.heif_plugin_type_decoder
+)
+
+// String returns the name of the plugin type.
+func (t PluginType) String() string {
+	switch t {
+	case PluginTypeEncoder:
+		return "encoder"
+	case PluginTypeDecoder:
+		return "decoder"
+	default:
+		return "unknown"
+	}
+}
+
+// Plugin is a dynamically loaded codec plugin.
+type Plugin struct {
+	info *C.struct_heif_plugin_info
+}
+
+func newPlugin(info *C.struct_heif_plugin_info) *Plugin {
+	return &Plugin{
+		info: info,
+	}
+}
+
+// Type returns the type of the plugin.
+func (p *Plugin) Type() PluginType {
+	if p.info == nil {
+		return PluginType(0)
+	}
+
+	return PluginType(p.info._type)
+}
+
+// Name returns the name of the codec provided by the plugin.
+func (p *Plugin) Name() string {
+	if p.info == nil {
+		return ""
+	}
+
+	return C.GoString(C.get_plugin_name(p.info))
+}
+
+// LoadPlugin loads the codec plugin from the given file. Loading a plugin
+// is not safe to be called concurrently with encoding or decoding images.
+func LoadPlugin(path string) (*Plugin, error) {
+	filename := C.CString(path)
+	defer C.free(unsafe.Pointer(filename))
+
+	var info *C.struct_heif_plugin_info
+	err := C.heif_load_plugin(filename, &info)
+	if err := convertHeifError(err); err != nil {
+		return nil, err
+	}
+
+	return newPlugin(info), nil
+}
+
+// LoadPlugins loads all codec plugins from the given directory. Loading
+// plugins is not safe to be called concurrently with encoding or decoding
+// images.
+func LoadPlugins(dir string) ([]*Plugin, error) {
+	// libheif stops loading plugins if the passed array is full, so reserve
+	// space for every file in the directory.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []*Plugin{}, nil
+	}
+
+	directory := C.CString(dir)
+	defer C.free(unsafe.Pointer(directory))
+
+	infos := make([]*C.struct_heif_plugin_info, len(entries))
+	var count C.int
+	cerr := C.heif_load_plugins(directory, &infos[0], &count, C.int(len(infos)))
+	if err := convertHeifError(cerr); err != nil {
+		return nil, err
+	}
+
+	result := make([]*Plugin, 0, int(count))
+	for _, info := range infos[:int(count)] {
+		result = append(result, newPlugin(info))
+	}
+	return result, nil
+}
+
+// UnloadPlugin unloads a plugin that was loaded with LoadPlugin or
+// LoadPlugins. The plugin may not be used afterwards.
+func UnloadPlugin(plugin *Plugin) error {
+	if plugin == nil || plugin.info == nil {
+		return errors.New("plugin is not loaded")
+	}
+
+	err := C.heif_unload_plugin(plugin.info)
+	if err := convertHeifError(err); err != nil {
+		return err
+	}
+
+	plugin.info = nil
+	return nil
+}
+
+// GetPluginDirectories returns the directories libheif loads plugins from
+// by default.
+func GetPluginDirectories() []string {
+	dirs := C.heif_get_plugin_directories()
+	if dirs == nil {
+		return []string{}
+	}
+	defer C.heif_free_plugin_directories(dirs)
+
+	result := []string{}
+	for p := dirs; *p != nil; p = nextPointer(p) {
+		result = append(result, C.GoString(*p))
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlugins(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, dir := range GetPluginDirectories() {
+		assert.NotEmpty(dir)
+	}
+
+	dir := t.TempDir()
+	if plugins, err := LoadPlugins(dir); assert.NoError(err) {
+		assert.Empty(plugins)
+	}
+	_, err := LoadPlugins(filepath.Join(dir, "missing"))
+	assert.Error(err)
+
+	_, err = LoadPlugin(filepath.Join(dir, "missing.so"))
+	assert.Error(err)
+	assert.Error(UnloadPlugin(nil))
+	assert.Error(UnloadPlugin(&Plugin{}))
+	assert.Equal("decoder", PluginTypeDecoder.String())
+}
@@ -0,0 +1,401 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"sync"
+)
+
+// ErrPoolPixelLimit is returned by Pool.Transcode if an image has more pixels
+// than the pool allows to be in flight in total.
+var ErrPoolPixelLimit = errors.New("image exceeds pixel limit of pool")
+
+// DefaultPoolMaxPixels is the default number of decoded pixels a Pool allows
+// to be in flight.
+const DefaultPoolMaxPixels = 256 << 20
+
+// PoolOptions configure a Pool.
+type PoolOptions struct {
+	// EncodersPerFormat is the maximum number of encoders per compression
+	// format, i.e. the number of concurrent encodings. Defaults to the
+	// number of CPUs.
+	EncodersPerFormat int
+	// MaxPixels is the maximum number of decoded pixels of all images that
+	// are transcoded concurrently. Defaults to DefaultPoolMaxPixels.
+	MaxPixels int64
+}
+
+// TranscodeOptions configure a single Pool.Transcode call.
+type TranscodeOptions struct {
+	// Format is the compression format of the output.
+	Format CompressionFormat
+	// Params are applied to the encoder after resetting the quality, the
+	// lossless mode and all parameters to their defaults. Encoders with
+	// changed parameters that have no default are not reused.
+	Params []EncoderParameterSetter
+	// DropAuxiliaryImages drops depth and other auxiliary images instead of
+	// failing with ErrAuxiliaryImages.
+	DropAuxiliaryImages bool
+}
+
+// pixelLimiter is a weighted semaphore that grants requests in FIFO order.
+type pixelLimiter struct {
+	mu        sync.Mutex
+	available int64
+	waiters   list.List
+}
+
+type pixelWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func (l *pixelLimiter) acquire(ctx context.Context, n int64) error {
+	l.mu.Lock()
+	if l.waiters.Len() == 0 && l.available >= n {
+		l.available -= n
+		l.mu.Unlock()
+		return nil
+	}
+
+	w := &pixelWaiter{
+		n:     n,
+		ready: make(chan struct{}),
+	}
+	elem := l.waiters.PushBack(w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired while the context was cancelled, give back.
+			l.available += n
+		default:
+			l.waiters.Remove(elem)
+		}
+		l.notify()
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *pixelLimiter) release(n int64) {
+	l.mu.Lock()
+	l.available += n
+	l.notify()
+	l.mu.Unlock()
+}
+
+// notify wakes up waiters that can be served, must be called with the mutex
+// held.
+func (l *pixelLimiter) notify() {
+	for {
+		front := l.waiters.Front()
+		if front == nil {
+			return
+		}
+
+		w := front.Value.(*pixelWaiter)
+		if l.available < w.n {
+			return
+		}
+
+		l.available -= w.n
+		l.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// encoderSet contains the encoders of one compression format.
+type encoderSet struct {
+	idle    chan *Encoder
+	created chan struct{}
+}
+
+// Pool transcodes images concurrently with a limited number of encoders
+// per compression format and a limit of decoded pixels in flight.
+//
+// Objects of this package like Context, ImageHandle, Image and Encoder
+// must not be used by multiple goroutines at the same time. A Pool is safe
+// for concurrent use, each encoder is only used by one transcoding at a
+// time.
+type Pool struct {
+	encodersPerFormat int
+	maxPixels         int64
+
+	mu       sync.Mutex
+	encoders map[CompressionFormat]*encoderSet
+
+	pixels pixelLimiter
+}
+
+// NewPool creates a new pool with the given options.
+func NewPool(options PoolOptions) *Pool {
+	p := &Pool{
+		encodersPerFormat: options.EncodersPerFormat,
+		maxPixels:         options.MaxPixels,
+		encoders:          make(map[CompressionFormat]*encoderSet),
+	}
+	if p.encodersPerFormat <= 0 {
+		p.encodersPerFormat = runtime.NumCPU()
+	}
+	if p.maxPixels <= 0 {
+		p.maxPixels = DefaultPoolMaxPixels
+	}
+	p.pixels.available = p.maxPixels
+	return p
+}
+
+func (p *Pool) getEncoderSet(format CompressionFormat) *encoderSet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set, found := p.encoders[format]
+	if !found {
+		set = &encoderSet{
+			idle:    make(chan *Encoder, p.encodersPerFormat),
+			created: make(chan struct{}, p.encodersPerFormat),
+		}
+		p.encoders[format] = set
+	}
+	return set
+}
+
+func newPoolEncoder(format CompressionFormat) (*Encoder, error) {
+	ctx, err := NewContext()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Close()
+
+	return ctx.NewEncoder(format)
+}
+
+// acquireEncoder returns an idle encoder for the format or creates a new one
+// if the limit has not been reached yet.
+func (p *Pool) acquireEncoder(ctx context.Context, format CompressionFormat) (*Encoder, error) {
+	set := p.getEncoderSet(format)
+	select {
+	case enc := <-set.idle:
+		return enc, nil
+	default:
+	}
+
+	select {
+	case enc := <-set.idle:
+		return enc, nil
+	case set.created <- struct{}{}:
+		enc, err := newPoolEncoder(format)
+		if err != nil {
+			<-set.created
+			return nil, err
+		}
+
+		return enc, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Pool) releaseEncoder(format CompressionFormat, enc *Encoder) {
+	p.getEncoderSet(format).idle <- enc
+}
+
+// discardEncoder closes the encoder, so a new one is created by the next
+// call to acquireEncoder.
+func (p *Pool) discardEncoder(format CompressionFormat, enc *Encoder) {
+	enc.Close()
+	<-p.getEncoderSet(format).created
+}
+
+// defaultEncoderQuality is the quality the libheif encoder plugins start
+// with if they don't have a "quality" parameter with a default.
+const defaultEncoderQuality = 50
+
+// resetEncoder restores the generic quality and lossless settings and the
+// default values of all encoder parameters, so parameters of a previous
+// transcoding don't leak into the next one. Parameters without a default
+// are not changed, see parametersWithoutDefault.
+func resetEncoder(enc *Encoder) error {
+	// Lossless mode takes precedence over the quality, so it is disabled
+	// first.
+	if err := enc.SetLossless(LosslessModeDisabled); err != nil {
+		return fmt.Errorf("failed to reset lossless mode: %w", err)
+	}
+
+	quality := defaultEncoderQuality
+	if defaults, err := enc.defaultParameters(); err == nil {
+		if q, ok := defaults["quality"].(int); ok {
+			quality = q
+		}
+	}
+	if err := enc.SetQuality(quality); err != nil {
+		return fmt.Errorf("failed to reset quality: %w", err)
+	}
+
+	for _, param := range enc.ListParameters() {
+		value, found := param.DefaultValue()
+		if !found {
+			continue
+		}
+
+		var err error
+		switch v := value.(type) {
+		case int:
+			err = enc.SetParameterInteger(param.Name(), v)
+		case bool:
+			err = enc.SetParameterBool(param.Name(), v)
+		case string:
+			err = enc.SetParameterString(param.Name(), v)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reset parameter %q: %w", param.Name(), err)
+		}
+	}
+	return nil
+}
+
+// parametersWithoutDefault returns the current values of all encoder
+// parameters that can't be restored by resetEncoder.
+func parametersWithoutDefault(enc *Encoder) map[string]string {
+	result := make(map[string]string)
+	for _, param := range enc.ListParameters() {
+		if _, found := param.DefaultValue(); found {
+			continue
+		}
+
+		value, err := enc.GetParameter(param.Name())
+		if err != nil {
+			continue
+		}
+
+		result[param.Name()] = value
+	}
+	return result
+}
+
+// Transcode reads a HEIF image from r, re-encodes all top-level images with
+// the given options and writes the result to w, see Transcode for details.
+// The call blocks until an encoder is available and the decoded pixels of
+// the image fit into the pool limit, or the context is done.
+func (p *Pool) Transcode(ctx context.Context, r io.Reader, w io.Writer, options TranscodeOptions) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	src, err := NewContext()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := src.ReadFromMemory(data); err != nil {
+		return err
+	}
+
+	var pixels int64
+	for _, id := range src.GetListOfTopLevelImageIDs() {
+		handle, err := src.GetImageHandle(id)
+		if err != nil {
+			return err
+		}
+
+		pixels += int64(handle.GetIspeWidth()) * int64(handle.GetIspeHeight())
+		handle.Close()
+	}
+	if pixels > p.maxPixels {
+		return ErrPoolPixelLimit
+	}
+
+	buf, err := p.transcode(ctx, src, pixels, options)
+	if err != nil {
+		return err
+	}
+
+	// The result is written after the encoder has been released, so a slow
+	// writer doesn't block other transcodings.
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (p *Pool) transcode(ctx context.Context, src *Context, pixels int64, options TranscodeOptions) (*bytes.Buffer, error) {
+	if err := p.pixels.acquire(ctx, pixels); err != nil {
+		return nil, err
+	}
+	defer p.pixels.release(pixels)
+
+	enc, err := p.acquireEncoder(ctx, options.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	// An encoder is only reused if the transcoding didn't change parameters
+	// that can't be reset, otherwise they would leak into the next one.
+	fixed := parametersWithoutDefault(enc)
+	reuse := true
+	defer func() {
+		if reuse && maps.Equal(fixed, parametersWithoutDefault(enc)) {
+			p.releaseEncoder(options.Format, enc)
+		} else {
+			p.discardEncoder(options.Format, enc)
+		}
+	}()
+
+	if err := resetEncoder(enc); err != nil {
+		reuse = false
+		return nil, err
+	}
+
+	for _, setter := range options.Params {
+		if err := setter(enc); err != nil {
+			return nil, fmt.Errorf("error setting parameter: %w", err)
+		}
+	}
+
+	out, err := NewContext()
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	if err := transcodeContext(out, enc, src, options.DropAuxiliaryImages); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := out.Write(&buf); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
@@ -0,0 +1,243 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPixelLimiter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l := &pixelLimiter{
+		available: 10,
+	}
+	ctx := context.Background()
+	require.NoError(l.acquire(ctx, 6))
+
+	// Requests that don't fit block until enough pixels are released.
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		assert.NoError(l.acquire(ctx, 8))
+	}()
+
+	assert.Eventually(func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+
+	// Waiters are served in order, so even small requests have to wait.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(l.acquire(timeoutCtx, 1), context.DeadlineExceeded)
+
+	select {
+	case <-acquired:
+		assert.Fail("should not have acquired")
+	default:
+	}
+
+	l.release(6)
+	<-acquired
+	l.release(8)
+	assert.EqualValues(10, l.available)
+	assert.Equal(0, l.waiters.Len())
+}
+
+func TestPixelLimiterStress(t *testing.T) {
+	l := &pixelLimiter{
+		available: 100,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%4)*time.Millisecond)
+			defer cancel()
+			for j := 0; j < 100; j++ {
+				n := int64(1 + (i+j)%50)
+				if err := l.acquire(ctx, n); err != nil {
+					ctx = context.Background()
+					continue
+				}
+				l.release(n)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 100, l.available)
+	assert.Equal(t, 0, l.waiters.Len())
+}
+
+func TestPool(t *testing.T) {
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.heic")
+	require.NoError(err)
+
+	pool := NewPool(PoolOptions{
+		EncodersPerFormat: 2,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert := assert.New(t)
+			for j := 0; j < 2; j++ {
+				var out bytes.Buffer
+				err := pool.Transcode(context.Background(), bytes.NewReader(data), &out, TranscodeOptions{
+					Format: CompressionHEVC,
+					Params: []EncoderParameterSetter{
+						SetEncoderQuality(10 + i*10),
+					},
+				})
+				if !assert.NoError(err) {
+					continue
+				}
+
+				ctx, err := NewContext()
+				if assert.NoError(err) {
+					assert.NoError(ctx.ReadFromMemory(out.Bytes()))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	limited := NewPool(PoolOptions{
+		MaxPixels: 100,
+	})
+	var out bytes.Buffer
+	err = limited.Transcode(context.Background(), bytes.NewReader(data), &out, TranscodeOptions{
+		Format: CompressionHEVC,
+	})
+	require.ErrorIs(err, ErrPoolPixelLimit)
+}
+
+// changeParameter sets the parameter to a valid value that differs from the
+// current one, returns false if no such value is known.
+func changeParameter(t *testing.T, enc *Encoder, param EncoderParameter) bool {
+	name := param.Name()
+	switch param.Type() {
+	case EncoderParameterTypeInteger:
+		current, err := enc.GetParameterInteger(name)
+		require.NoError(t, err)
+		minimum, maximum, values, err := param.IntegerValues()
+		require.NoError(t, err)
+		if minimum != nil {
+			values = append(values, *minimum)
+		}
+		if maximum != nil {
+			values = append(values, *maximum)
+		}
+		for _, v := range values {
+			if v != current {
+				return assert.NoError(t, enc.SetParameterInteger(name, v))
+			}
+		}
+	case EncoderParameterTypeBoolean:
+		current, err := enc.GetParameterBool(name)
+		require.NoError(t, err)
+		return assert.NoError(t, enc.SetParameterBool(name, !current))
+	case EncoderParameterTypeString:
+		current, err := enc.GetParameterString(name)
+		require.NoError(t, err)
+		values, err := param.StringValues()
+		require.NoError(t, err)
+		for _, v := range values {
+			if v != current {
+				return assert.NoError(t, enc.SetParameterString(name, v))
+			}
+		}
+	}
+	return false
+}
+
+func TestPoolResetsEncoder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.heic")
+	require.NoError(err)
+
+	fresh, err := newPoolEncoder(CompressionHEVC)
+	require.NoError(err)
+	defer fresh.Close()
+
+	expected := make(map[string]string)
+	for _, param := range fresh.ListParameters() {
+		if value, err := fresh.GetParameter(param.Name()); err == nil {
+			expected[param.Name()] = value
+		}
+	}
+
+	pool := NewPool(PoolOptions{
+		EncodersPerFormat: 1,
+	})
+
+	var changed []string
+	var out bytes.Buffer
+	require.NoError(pool.Transcode(context.Background(), bytes.NewReader(data), &out, TranscodeOptions{
+		Format: CompressionHEVC,
+		Params: []EncoderParameterSetter{
+			SetEncoderLossless(LosslessModeEnabled),
+			func(enc *Encoder) error {
+				for _, param := range enc.ListParameters() {
+					if changeParameter(t, enc, param) {
+						changed = append(changed, param.Name())
+					}
+				}
+				return nil
+			},
+		},
+	}))
+	require.NotEmpty(changed)
+
+	out.Reset()
+	require.NoError(pool.Transcode(context.Background(), bytes.NewReader(data), &out, TranscodeOptions{
+		Format: CompressionHEVC,
+		Params: []EncoderParameterSetter{
+			func(enc *Encoder) error {
+				for _, name := range changed {
+					value, err := enc.GetParameter(name)
+					if assert.NoError(err, name) {
+						assert.Equal(expected[name], value, name)
+					}
+				}
+				return nil
+			},
+		},
+	}))
+}
@@ -0,0 +1,329 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libheif/heif.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// ErrAuxiliaryImages is returned by Transcode if the source contains depth
+// or other auxiliary images, which libheif can't add to a new context. Use
+// DropAuxiliaryImages to transcode such files without them.
+var ErrAuxiliaryImages = errors.New("auxiliary images can not be transcoded")
+
+// copyColorProfiles copies the ICC and nclx color profiles of the handle to
+// the image.
+func copyColorProfiles(handle *ImageHandle, img *Image) error {
+	defer runtime.KeepAlive(handle)
+	defer runtime.KeepAlive(img)
+
+	if size := C.heif_image_handle_get_raw_color_profile_size(handle.handle); size > 0 {
+		profileType := uint32(C.heif_image_handle_get_color_profile_type(handle.handle))
+		if profileType != C.heif_color_profile_type_rICC {
+			// Raw color profile data is always ICC.
+			profileType = C.heif_color_profile_type_prof
+		}
+
+		data := make([]byte, size)
+		err := C.heif_image_handle_get_raw_color_profile(handle.handle, unsafe.Pointer(&data[0]))
+		if err := convertHeifError(err); err != nil {
+			return err
+		}
+
+		fourcc := C.CString(string([]byte{
+			byte(profileType >> 24), byte(profileType >> 16), byte(profileType >> 8), byte(profileType),
+		}))
+		defer C.free(unsafe.Pointer(fourcc))
+		err = C.heif_image_set_raw_color_profile(img.image, fourcc, unsafe.Pointer(&data[0]), size)
+		if err := convertHeifError(err); err != nil {
+			return err
+		}
+	}
+
+	var nclx *C.struct_heif_color_profile_nclx
+	if err := C.heif_image_handle_get_nclx_color_profile(handle.handle, &nclx); err.code == C.heif_error_Ok {
+		defer C.heif_nclx_color_profile_free(nclx)
+		err = C.heif_image_set_nclx_color_profile(img.image, nclx)
+		if err := convertHeifError(err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyMetadata copies all metadata blocks from the source handle to the
+// destination handle.
+func copyMetadata(dst *Context, dstHandle *ImageHandle, src *ImageHandle) error {
+	for _, id := range src.GetMetadataBlockIDs("") {
+		data, err := src.GetMetadata(id)
+		if err != nil {
+			return err
+		}
+
+		itemType := src.GetMetadataItemType(id)
+		contentType := src.GetMetadataContentType(id)
+		switch {
+		case itemType == "Exif":
+			// The TIFF header offset is added again by libheif.
+			if data, err = splitExifMetadata(data); err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				continue
+			}
+
+			err = dst.AddExifMetadata(dstHandle, data)
+		case len(data) == 0:
+			continue
+		case itemType == "uri ":
+			err = dst.AddGenericURIMetadata(dstHandle, data, src.GetMetadataItemURIType(id))
+		case itemType == "mime" && contentType == XMPContentType:
+			err = dst.AddXmpMetadata(dstHandle, data)
+		default:
+			err = dst.AddGenericMetadata(dstHandle, data, itemType, contentType)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy metadata block %d: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// transcodeImage decodes the image of the handle and encodes it to the
+// destination context. Transformations are not applied but copied, so
+// the pixel data is not rotated or cropped. With libheif before 1.18, the
+// transformations can't be copied and are applied to the pixel data instead.
+func transcodeImage(dst *Context, encoder *Encoder, handle *ImageHandle) (*ImageHandle, error) {
+	decodingOptions, err := NewDecodingOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer decodingOptions.Close()
+	decodingOptions.SetIgnoreTransformations(haveTransformationProperties)
+
+	img, err := handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, decodingOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %d: %w", handle.GetItemID(), err)
+	}
+	defer img.Close()
+
+	if err := copyColorProfiles(handle, img); err != nil {
+		return nil, fmt.Errorf("failed to copy color profiles of image %d: %w", handle.GetItemID(), err)
+	}
+
+	if handle.HasAlphaChannel() {
+		C.heif_image_set_premultiplied_alpha(img.image, convertBool[C.int](handle.IsPremultipliedAlpha()))
+		runtime.KeepAlive(img)
+	}
+
+	var transformations []Transformation
+	if haveTransformationProperties {
+		if transformations, err = handle.GetTransformations(); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := dst.EncodeImage(img, encoder, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image %d: %w", handle.GetItemID(), err)
+	}
+
+	for _, t := range transformations {
+		switch t := t.(type) {
+		case RotationTransformation:
+			err = dst.AddRotation(result, t.Angle)
+		case MirrorTransformation:
+			err = dst.AddMirror(result, t.Direction)
+		case CleanApertureTransformation:
+			err = dst.AddCleanAperture(result, t.Rect)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy transformations of image %d: %w", handle.GetItemID(), err)
+		}
+	}
+
+	return result, nil
+}
+
+// Transcode re-encodes all top-level images of the source context with the
+// given compression format into a new context.
+//
+// Metadata blocks (EXIF, XMP and others), color profiles, transformations,
+// alpha channels, thumbnails and the primary image designation are carried
+// over. Depth images and other auxiliary images are not: libheif reads them
+// with heif_image_handle_get_depth_image_handle and
+// heif_image_handle_get_auxiliary_image_handle, but has no function to add
+// them to a context. ErrAuxiliaryImages is returned if the source contains
+// any, unless DropAuxiliaryImages is passed.
+//
+// The encoder is configured by EncoderParameterSetter and UseEncoder options.
+// Options that add data to a single image like WithExif or WithThumbnail are
+// not supported and return an error.
+func Transcode(src *Context, dst CompressionFormat, opts ...EncodeOption) (*Context, error) {
+	if err := checkLibraryVersion(); err != nil {
+		return nil, err
+	}
+
+	var options encodeOptions
+	for _, opt := range opts {
+		opt.applyEncodeOption(&options)
+	}
+	if options.exif != nil || options.xmp != nil || options.orientation != 0 ||
+		options.thumbnailSize > 0 || options.stripGPS || options.normalizeOrientation {
+		return nil, errors.New("only encoder options are supported when transcoding")
+	}
+
+	ctx, err := NewContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HEIF context: %w", err)
+	}
+
+	var enc *Encoder
+	if options.encoderID != "" {
+		enc, err = ctx.newEncoderByID(options.encoderID, dst)
+	} else {
+		enc, err = ctx.NewEncoder(dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encoder: %w", err)
+	}
+	defer enc.Close()
+
+	for _, setter := range options.setters {
+		if err := setter(enc); err != nil {
+			return nil, fmt.Errorf("error setting parameter: %w", err)
+		}
+	}
+
+	if err := transcodeContext(ctx, enc, src, options.dropAuxiliaryImages); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// checkAuxiliaryImages returns ErrAuxiliaryImages if any top-level image of
+// the context has depth or other auxiliary images.
+func checkAuxiliaryImages(src *Context) error {
+	for _, id := range src.GetListOfTopLevelImageIDs() {
+		handle, err := src.GetImageHandle(id)
+		if err != nil {
+			return err
+		}
+
+		aux := handle.GetNumberOfDepthImages() + handle.GetNumberOfAuxiliaryImages()
+		handle.Close()
+		if aux > 0 {
+			return fmt.Errorf("image %d has %d auxiliary images: %w", id, aux, ErrAuxiliaryImages)
+		}
+	}
+
+	return nil
+}
+
+// transcodeContext encodes all top-level images of the source context to the
+// destination context using the encoder.
+func transcodeContext(ctx *Context, enc *Encoder, src *Context, dropAuxiliaryImages bool) error {
+	if !dropAuxiliaryImages {
+		if err := checkAuxiliaryImages(src); err != nil {
+			return err
+		}
+	}
+
+	primaryID, err := src.GetPrimaryImageID()
+	if err != nil {
+		return fmt.Errorf("failed to get primary image: %w", err)
+	}
+
+	for _, id := range src.GetListOfTopLevelImageIDs() {
+		if err := transcodeTopLevelImage(ctx, enc, src, id, id == primaryID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transcodeTopLevelImage encodes a top-level image of the source context
+// together with its metadata and thumbnails to the destination context.
+func transcodeTopLevelImage(ctx *Context, enc *Encoder, src *Context, id int, primary bool) error {
+	handle, err := src.GetImageHandle(id)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	out, err := transcodeImage(ctx, enc, handle)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := copyMetadata(ctx, out, handle); err != nil {
+		return err
+	}
+
+	for _, thumbnailID := range handle.GetListOfThumbnailIDs() {
+		if err := transcodeThumbnail(ctx, enc, handle, out, thumbnailID); err != nil {
+			return err
+		}
+	}
+
+	if primary {
+		if err := ctx.SetPrimaryImage(out); err != nil {
+			return fmt.Errorf("failed to set primary image: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// transcodeThumbnail encodes a thumbnail of the source handle and assigns it
+// to the destination handle.
+func transcodeThumbnail(ctx *Context, enc *Encoder, handle *ImageHandle, out *ImageHandle, thumbnailID int) error {
+	thumbnail, err := handle.GetThumbnail(thumbnailID)
+	if err != nil {
+		return err
+	}
+	defer thumbnail.Close()
+
+	outThumbnail, err := transcodeImage(ctx, enc, thumbnail)
+	if err != nil {
+		return err
+	}
+	defer outThumbnail.Close()
+
+	if err := ctx.AssignThumbnail(out, outThumbnail); err != nil {
+		return fmt.Errorf("failed to assign thumbnail %d: %w", thumbnailID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMetadataURI = "urn:example:metadata"
+
+func TestTranscode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.xmp")
+	require.NoError(err)
+	x, err := ParseXMP(data)
+	require.NoError(err)
+
+	e := NewExif()
+	e.SetMake("Example")
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	ctx, handle, err := EncodeFromImageWithOptions(img, CompressionHEVC,
+		SetEncoderQuality(50),
+		WithExif(e),
+		WithXMP(x),
+	)
+	require.NoError(err)
+	if haveTransformationProperties {
+		require.NoError(ctx.AddRotation(handle, 90))
+	}
+	require.NoError(ctx.AddGenericMetadata(handle, []byte("custom"), "mime", "text/plain"))
+	require.NoError(ctx.AddGenericURIMetadata(handle, []byte("uri data"), testMetadataURI))
+	assert.Error(ctx.AddGenericURIMetadata(handle, nil, testMetadataURI))
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+	src, err := NewContext()
+	require.NoError(err)
+	require.NoError(src.ReadFromMemory(out.Bytes()))
+
+	transcoded, err := Transcode(src, CompressionHEVC, SetEncoderQuality(50))
+	require.NoError(err)
+	handle = reloadPrimaryImage(t, transcoded)
+
+	if haveTransformationProperties {
+		if transformations, err := handle.GetTransformations(); assert.NoError(err) {
+			assert.Equal([]Transformation{
+				RotationTransformation{Angle: 90},
+			}, transformations)
+		}
+	}
+	if exif, err := handle.GetExif(); assert.NoError(err) && assert.NotNil(exif) {
+		assert.Equal("Example", exif.Make)
+	}
+	if x2, err := handle.GetXMP(); assert.NoError(err) && assert.NotNil(x2) {
+		checkExampleXMP(t, x2)
+	}
+	found := false
+	for _, id := range handle.GetMetadataBlockIDs("mime") {
+		if handle.GetMetadataContentType(id) == "text/plain" {
+			data, err := handle.GetMetadata(id)
+			assert.NoError(err)
+			assert.Equal([]byte("custom"), data)
+			found = true
+		}
+	}
+	assert.True(found, "custom metadata not found")
+
+	if ids := handle.GetMetadataBlockIDs("uri "); assert.Len(ids, 1) {
+		assert.Equal("uri ", handle.GetMetadataItemType(ids[0]))
+		assert.Equal(testMetadataURI, handle.GetMetadataItemURIType(ids[0]))
+		data, err := handle.GetMetadata(ids[0])
+		assert.NoError(err)
+		assert.Equal([]byte("uri data"), data)
+	}
+	if ids := handle.GetMetadataBlockIDs("Exif"); assert.Len(ids, 1) {
+		assert.Equal("Exif", handle.GetMetadataItemType(ids[0]))
+		assert.Equal("", handle.GetMetadataItemURIType(ids[0]))
+	}
+}
+
+func TestTranscodeFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	src, err := NewContext()
+	require.NoError(err)
+	require.NoError(src.ReadFromFile("testdata/example.heic"))
+
+	ctx, err := Transcode(src, CompressionHEVC, SetEncoderQuality(50))
+	require.NoError(err)
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+	transcoded, err := NewContext()
+	require.NoError(err)
+	require.NoError(transcoded.ReadFromMemory(out.Bytes()))
+
+	assert.Equal(src.GetNumberOfTopLevelImages(), transcoded.GetNumberOfTopLevelImages())
+	srcPrimary, err := src.GetPrimaryImageHandle()
+	require.NoError(err)
+	primary, err := transcoded.GetPrimaryImageHandle()
+	require.NoError(err)
+	assert.Equal(srcPrimary.GetWidth(), primary.GetWidth())
+	assert.Equal(srcPrimary.GetHeight(), primary.GetHeight())
+	assert.Equal(srcPrimary.GetNumberOfThumbnails(), primary.GetNumberOfThumbnails())
+}
+
+func TestTranscodeOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	src, err := NewContext()
+	require.NoError(err)
+	defer src.Close()
+	require.NoError(src.ReadFromFile("testdata/example.heic"))
+
+	for _, opt := range []EncodeOption{
+		WithExif(NewExif()),
+		WithThumbnail(64),
+		WithImageOrientation(OrientationRotate90Cw),
+		StripGPS(),
+	} {
+		_, err := Transcode(src, CompressionHEVC, opt)
+		assert.Error(err)
+	}
+
+	// The example has no depth or auxiliary images.
+	assert.NoError(checkAuxiliaryImages(src))
+
+	encoders := ListEncoders(CompressionHEVC, false)
+	require.NotEmpty(encoders)
+	ctx, err := Transcode(src, CompressionHEVC,
+		UseEncoder(encoders[0].ID),
+		DropAuxiliaryImages(),
+		SetEncoderQuality(30),
+	)
+	require.NoError(err)
+	defer ctx.Close()
+	assert.Equal(src.GetNumberOfTopLevelImages(), ctx.GetNumberOfTopLevelImages())
+}
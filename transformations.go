@@ -0,0 +1,320 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+// #cgo pkg-config: libheif
+/*
+#include <stdlib.h>
+#include <string.h>
+#include <libheif/heif.h>
+
+// Access to transformation properties was added in libheif 1.18.
+#if LIBHEIF_HAVE_VERSION(1, 18, 0)
+#include <libheif/heif_properties.h>
+
+#define HAVE_TRANSFORMATION_PROPERTIES 1
+#else
+#define HAVE_TRANSFORMATION_PROPERTIES 0
+#endif
+
+enum {
+	transformation_unknown,
+	transformation_rotation,
+	transformation_mirror,
+	transformation_crop,
+};
+
+static int get_transformation_properties(const struct heif_context* ctx, heif_item_id id, uint32_t* out_list, int count) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	return heif_item_get_transformation_properties(ctx, id, out_list, count);
+#else
+	return -1;
+#endif
+}
+
+static int get_transformation_type(const struct heif_context* ctx, heif_item_id id, uint32_t property) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	switch (heif_item_get_property_type(ctx, id, property)) {
+		case heif_item_property_type_transform_rotation:
+			return transformation_rotation;
+		case heif_item_property_type_transform_mirror:
+			return transformation_mirror;
+		case heif_item_property_type_transform_crop:
+			return transformation_crop;
+		default:
+			break;
+	}
+#endif
+	return transformation_unknown;
+}
+
+static int get_transformation_rotation(const struct heif_context* ctx, heif_item_id id, uint32_t property) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	return heif_item_get_property_transform_rotation_ccw(ctx, id, property);
+#else
+	return -1;
+#endif
+}
+
+static int get_transformation_mirror(const struct heif_context* ctx, heif_item_id id, uint32_t property) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	return heif_item_get_property_transform_mirror(ctx, id, property);
+#else
+	return -1;
+#endif
+}
+
+static void get_transformation_crop_borders(const struct heif_context* ctx, heif_item_id id, uint32_t property,
+		int width, int height, int* left, int* top, int* right, int* bottom) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	heif_item_get_property_transform_crop_borders(ctx, id, property, width, height, left, top, right, bottom);
+#else
+	*left = *top = *right = *bottom = 0;
+#endif
+}
+
+static struct heif_error add_transformation_property(struct heif_context* ctx, heif_item_id id, uint32_t type, const uint8_t* data, size_t size) {
+#if HAVE_TRANSFORMATION_PROPERTIES
+	// Transformative properties must always be marked as essential.
+	return heif_item_add_raw_property(ctx, id, type, NULL, data, size, 1, NULL);
+#else
+	struct heif_error err = {
+		heif_error_Unsupported_feature,
+		heif_suberror_Unspecified,
+		"Adding transformations requires libheif 1.18",
+	};
+	return err;
+#endif
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"runtime"
+	"unsafe"
+)
+
+// haveTransformationProperties is true if libheif supports reading and
+// adding transformations of images.
+const haveTransformationProperties = C.HAVE_TRANSFORMATION_PROPERTIES != 0
+
+// errTransformationsUnsupported is returned if transformations are accessed
+// with libheif before 1.18.
+var errTransformationsUnsupported = fmt.Errorf("transformations require libheif 1.18: %w", errors.ErrUnsupported)
+
+// MirrorDirection defines the axis an image is mirrored along. The values
+// match the "imir" property and enum heif_transform_mirror_direction.
+type MirrorDirection int
+
+const (
+	// MirrorDirectionVertical flips the image vertically, i.e. top and
+	// bottom are swapped.
+	MirrorDirectionVertical MirrorDirection = 0
+	// MirrorDirectionHorizontal flips the image horizontally, i.e. left and
+	// right are swapped.
+	MirrorDirectionHorizontal MirrorDirection = 1
+)
+
+// Transformation is a geometric transformation that is applied to an image
+// while decoding (unless DecodingOptions.SetIgnoreTransformations is used).
+// It is one of RotationTransformation, MirrorTransformation or
+// CleanApertureTransformation.
+type Transformation interface {
+	isTransformation()
+}
+
+// RotationTransformation rotates the image counter-clockwise ("irot").
+type RotationTransformation struct {
+	// Angle is the rotation in degrees counter-clockwise, one of 0, 90, 180
+	// or 270.
+	Angle int
+}
+
+func (RotationTransformation) isTransformation() {}
+
+// MirrorTransformation mirrors the image ("imir").
+type MirrorTransformation struct {
+	Direction MirrorDirection
+}
+
+func (MirrorTransformation) isTransformation() {}
+
+// CleanApertureTransformation crops the image to a rectangle ("clap").
+type CleanApertureTransformation struct {
+	// Rect is the part of the image that is kept, relative to the image
+	// size at the point the transformation is applied.
+	Rect image.Rectangle
+}
+
+func (CleanApertureTransformation) isTransformation() {}
+
+// GetTransformations returns the geometric transformations of the image in
+// the order they are applied while decoding. An error wrapping
+// errors.ErrUnsupported is returned if libheif is older than 1.18.
+func (h *ImageHandle) GetTransformations() ([]Transformation, error) {
+	result, _, _, err := h.getTransformations()
+	return result, err
+}
+
+// getTransformations returns the transformations of the image and the size of
+// the image after all of them have been applied.
+func (h *ImageHandle) getTransformations() ([]Transformation, int, int, error) {
+	defer runtime.KeepAlive(h)
+
+	if h.ctx == nil {
+		return nil, 0, 0, errors.New("image handle has no context")
+	}
+
+	if h.handle == nil || h.ctx.context == nil {
+		return nil, 0, 0, ErrClosed
+	}
+
+	ctx := h.ctx.context
+	defer runtime.KeepAlive(h.ctx)
+
+	id := C.heif_image_handle_get_item_id(h.handle)
+	num := int(C.get_transformation_properties(ctx, id, nil, 0))
+	if num < 0 {
+		return nil, 0, 0, errTransformationsUnsupported
+	}
+
+	// Crop borders depend on the image size at the time the crop is applied.
+	width := int(C.heif_image_handle_get_ispe_width(h.handle))
+	height := int(C.heif_image_handle_get_ispe_height(h.handle))
+	if num == 0 {
+		return []Transformation{}, width, height, nil
+	}
+
+	properties := make([]C.uint32_t, num)
+	num = int(C.get_transformation_properties(ctx, id, &properties[0], C.int(num)))
+
+	result := make([]Transformation, 0, num)
+	for _, property := range properties[:num] {
+		switch t := C.get_transformation_type(ctx, id, property); t {
+		case C.transformation_rotation:
+			angle := int(C.get_transformation_rotation(ctx, id, property))
+			if angle < 0 {
+				return nil, 0, 0, fmt.Errorf("invalid rotation in property %d", property)
+			}
+
+			if angle == 90 || angle == 270 {
+				width, height = height, width
+			}
+			result = append(result, RotationTransformation{
+				Angle: angle,
+			})
+		case C.transformation_mirror:
+			direction := MirrorDirection(C.get_transformation_mirror(ctx, id, property))
+			if direction != MirrorDirectionVertical && direction != MirrorDirectionHorizontal {
+				return nil, 0, 0, fmt.Errorf("invalid mirror direction in property %d", property)
+			}
+
+			result = append(result, MirrorTransformation{
+				Direction: direction,
+			})
+		case C.transformation_crop:
+			var left, top, right, bottom C.int
+			C.get_transformation_crop_borders(ctx, id, property,
+				C.int(width), C.int(height),
+				&left, &top, &right, &bottom,
+			)
+			rect := image.Rect(int(left), int(top), width-int(right), height-int(bottom))
+			width = rect.Dx()
+			height = rect.Dy()
+			result = append(result, CleanApertureTransformation{
+				Rect: rect,
+			})
+		default:
+			return nil, 0, 0, fmt.Errorf("unsupported transformation in property %d", property)
+		}
+	}
+
+	return result, width, height, nil
+}
+
+func (c *Context) addTransformationProperty(handle *ImageHandle, fourcc string, data []byte) error {
+	defer runtime.KeepAlive(c)
+	defer runtime.KeepAlive(handle)
+
+	if c.context == nil || handle.handle == nil {
+		return ErrClosed
+	}
+
+	t := uint32(fourcc[0])<<24 | uint32(fourcc[1])<<16 | uint32(fourcc[2])<<8 | uint32(fourcc[3])
+	id := C.heif_image_handle_get_item_id(handle.handle)
+	dataPtr := (*C.uint8_t)(unsafe.Pointer(&data[0]))
+	err := C.add_transformation_property(c.context, id, C.uint32_t(t), dataPtr, C.size_t(len(data)))
+	return convertHeifError(err)
+}
+
+// AddRotation adds a rotation by the given angle in degrees counter-clockwise
+// to the image. The angle must be a multiple of 90. The pixel data of the
+// image is not modified, the rotation is applied when decoding.
+func (c *Context) AddRotation(handle *ImageHandle, angle int) error {
+	angle = ((angle % 360) + 360) % 360
+	if angle%90 != 0 {
+		return fmt.Errorf("unsupported rotation angle %d", angle)
+	}
+
+	return c.addTransformationProperty(handle, "irot", []byte{byte(angle / 90)})
+}
+
+// AddMirror adds mirroring in the given direction to the image. The pixel
+// data of the image is not modified, the mirroring is applied when decoding.
+func (c *Context) AddMirror(handle *ImageHandle, direction MirrorDirection) error {
+	if direction != MirrorDirectionVertical && direction != MirrorDirectionHorizontal {
+		return fmt.Errorf("unsupported mirror direction %d", direction)
+	}
+
+	return c.addTransformationProperty(handle, "imir", []byte{byte(direction)})
+}
+
+// AddCleanAperture adds cropping of the image to the given rectangle. The
+// rectangle is relative to the image size after all transformations that
+// have been added to the image before. The pixel data of the image is not
+// modified, the cropping is applied when decoding.
+func (c *Context) AddCleanAperture(handle *ImageHandle, rect image.Rectangle) error {
+	_, width, height, err := handle.getTransformations()
+	if err != nil {
+		return err
+	}
+
+	if rect.Empty() || !rect.In(image.Rect(0, 0, width, height)) {
+		return fmt.Errorf("clean aperture %v outside of image size %dx%d", rect, width, height)
+	}
+
+	// The clean aperture is defined by its size and the offset of its center
+	// from the center of the image, stored as fractions.
+	values := []int32{
+		int32(rect.Dx()), 1,
+		int32(rect.Dy()), 1,
+		int32(2*rect.Min.X + rect.Dx() - width), 2,
+		int32(2*rect.Min.Y + rect.Dy() - height), 2,
+	}
+	data := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		data = binary.BigEndian.AppendUint32(data, uint32(v))
+	}
+	return c.addTransformationProperty(handle, "clap", data)
+}
@@ -0,0 +1,129 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeSize(t *testing.T, handle *ImageHandle, ignoreTransformations bool) image.Point {
+	t.Helper()
+	require := require.New(t)
+
+	options, err := NewDecodingOptions()
+	require.NoError(err)
+	options.SetIgnoreTransformations(ignoreTransformations)
+
+	img, err := handle.DecodeImage(ColorspaceUndefined, ChromaUndefined, options)
+	require.NoError(err)
+	return image.Pt(img.GetWidth(ChannelY), img.GetHeight(ChannelY))
+}
+
+func reloadPrimaryImage(t *testing.T, ctx *Context) *ImageHandle {
+	t.Helper()
+	require := require.New(t)
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+
+	ctx2, err := NewContext()
+	require.NoError(err)
+	require.NoError(ctx2.ReadFromMemory(out.Bytes()))
+
+	handle, err := ctx2.GetPrimaryImageHandle()
+	require.NoError(err)
+	return handle
+}
+
+func TestAddTransformations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	size := img.Bounds().Size()
+	ctx, handle, err := EncodeFromImage(img, CompressionHEVC, SetEncoderQuality(50))
+	require.NoError(err)
+
+	if !haveTransformationProperties {
+		_, err := handle.GetTransformations()
+		assert.ErrorIs(err, errors.ErrUnsupported)
+		assert.Error(ctx.AddRotation(handle, 90))
+		t.Skip("transformations require libheif 1.18")
+	}
+
+	crop := image.Rect(10, 20, size.Y/2, size.X/2)
+	require.NoError(ctx.AddRotation(handle, 90))
+	require.NoError(ctx.AddMirror(handle, MirrorDirectionHorizontal))
+	require.NoError(ctx.AddCleanAperture(handle, crop))
+	assert.Error(ctx.AddRotation(handle, 45))
+	assert.Error(ctx.AddCleanAperture(handle, image.Rect(0, 0, size.X+1, size.Y)))
+
+	handle = reloadPrimaryImage(t, ctx)
+	if transformations, err := handle.GetTransformations(); assert.NoError(err) {
+		assert.Equal([]Transformation{
+			RotationTransformation{Angle: 90},
+			MirrorTransformation{Direction: MirrorDirectionHorizontal},
+			CleanApertureTransformation{Rect: crop},
+		}, transformations)
+	}
+
+	assert.Equal(size, decodeSize(t, handle, true))
+	assert.Equal(crop.Size(), decodeSize(t, handle, false))
+}
+
+func TestEncodeImageOrientation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	src := loadImage(t, "testdata/example-1.jpg")
+	size := src.Bounds().Size()
+	img, err := imageFromYCbCr(src.(*image.YCbCr))
+	require.NoError(err)
+
+	ctx, err := NewContext()
+	require.NoError(err)
+	enc, err := ctx.NewEncoder(CompressionHEVC)
+	require.NoError(err)
+	options, err := NewEncodingOptions()
+	require.NoError(err)
+	options.SetImageOrientation(OrientationRotate90Cw)
+	assert.Equal(OrientationRotate90Cw, options.GetImageOrientation())
+
+	_, err = ctx.EncodeImage(img, enc, options)
+	require.NoError(err)
+
+	handle := reloadPrimaryImage(t, ctx)
+	if haveTransformationProperties {
+		if transformations, err := handle.GetTransformations(); assert.NoError(err) {
+			assert.Equal([]Transformation{
+				RotationTransformation{Angle: 270},
+			}, transformations)
+		}
+	}
+
+	assert.Equal(size, decodeSize(t, handle, true))
+	assert.Equal(image.Pt(size.Y, size.X), decodeSize(t, handle, false))
+}
@@ -0,0 +1,557 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Namespaces of commonly used XMP properties.
+const (
+	// NamespaceDC is the Dublin Core namespace (title, creator, subject, ...).
+	NamespaceDC = "http://purl.org/dc/elements/1.1/"
+	// NamespaceXMP is the XMP basic namespace (rating, create date, ...).
+	NamespaceXMP = "http://ns.adobe.com/xap/1.0/"
+	// NamespaceRDF is the namespace of the RDF structure of XMP packets.
+	NamespaceRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+	namespaceXMPMeta = "adobe:ns:meta/"
+	namespaceXML     = "http://www.w3.org/XML/1998/namespace"
+)
+
+// XMPContentType is the content type of XMP metadata blocks.
+const XMPContentType = "application/rdf+xml"
+
+var defaultXMPPrefixes = map[string]string{
+	NamespaceDC:      "dc",
+	NamespaceXMP:     "xmp",
+	NamespaceRDF:     "rdf",
+	namespaceXMPMeta: "x",
+	namespaceXML:     "xml",
+}
+
+// XMPArrayType defines how the items of an array property are interpreted.
+type XMPArrayType string
+
+const (
+	// XMPArrayOrdered is an ordered array (rdf:Seq).
+	XMPArrayOrdered XMPArrayType = "Seq"
+	// XMPArrayUnordered is an unordered array (rdf:Bag).
+	XMPArrayUnordered XMPArrayType = "Bag"
+	// XMPArrayAlternative contains alternatives, e.g. for different
+	// languages (rdf:Alt).
+	XMPArrayAlternative XMPArrayType = "Alt"
+)
+
+type xmpNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmpNode
+	text     string
+}
+
+func (n *xmpNode) attr(space, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (n *xmpNode) child(space, local string) *xmpNode {
+	for _, c := range n.children {
+		if c.name.Space == space && c.name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *xmpNode) find(space, local string) *xmpNode {
+	if n.name.Space == space && n.name.Local == local {
+		return n
+	}
+
+	for _, c := range n.children {
+		if found := c.find(space, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// XMP contains a parsed XMP packet. Properties are identified by their
+// namespace URI and name. The zero value is an empty packet.
+type XMP struct {
+	root     *xmpNode
+	prefixes map[string]string
+}
+
+// NewXMP creates an empty XMP packet.
+func NewXMP() *XMP {
+	return &XMP{
+		root: &xmpNode{
+			name: xml.Name{Space: namespaceXMPMeta, Local: "xmpmeta"},
+			children: []*xmpNode{
+				{
+					name: xml.Name{Space: NamespaceRDF, Local: "RDF"},
+				},
+			},
+		},
+		prefixes: make(map[string]string),
+	}
+}
+
+// ParseXMP parses the given XMP packet.
+func ParseXMP(data []byte) (*XMP, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	x := &XMP{
+		prefixes: make(map[string]string),
+	}
+
+	var stack []*xmpNode
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid XMP data: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmpNode{
+				name: t.Name,
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					if _, found := x.prefixes[a.Value]; !found {
+						x.prefixes[a.Value] = a.Name.Local
+					}
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					// Default namespaces are resolved by the decoder.
+				default:
+					node.attrs = append(node.attrs, a)
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if x.root == nil {
+				x.root = node
+			} else {
+				return nil, errors.New("invalid XMP data: multiple root elements")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			if len(node.children) > 0 {
+				node.text = ""
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if x.root == nil {
+		return nil, errors.New("invalid XMP data: no root element")
+	}
+
+	if x.root.name.Space == NamespaceRDF && x.root.name.Local == "RDF" {
+		x.root = &xmpNode{
+			name:     xml.Name{Space: namespaceXMPMeta, Local: "xmpmeta"},
+			children: []*xmpNode{x.root},
+		}
+	} else if x.root.find(NamespaceRDF, "RDF") == nil {
+		return nil, errors.New("invalid XMP data: no RDF element")
+	}
+
+	return x, nil
+}
+
+func (x *XMP) rdf() *xmpNode {
+	if x.root == nil {
+		return nil
+	}
+
+	return x.root.find(NamespaceRDF, "RDF")
+}
+
+func (x *XMP) descriptions() []*xmpNode {
+	rdf := x.rdf()
+	if rdf == nil {
+		return nil
+	}
+
+	var result []*xmpNode
+	for _, c := range rdf.children {
+		if c.name.Space == NamespaceRDF && c.name.Local == "Description" {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Get returns the value of a simple property. For language alternatives
+// (e.g. dc:title), the default value is returned.
+func (x *XMP) Get(namespace, name string) (string, bool) {
+	for _, d := range x.descriptions() {
+		if value, found := d.attr(namespace, name); found {
+			return value, true
+		}
+
+		node := d.child(namespace, name)
+		if node == nil {
+			continue
+		}
+
+		if values, typ := arrayValues(node); typ != "" {
+			if typ == XMPArrayAlternative {
+				for _, li := range node.children[0].children {
+					if lang, _ := li.attr(namespaceXML, "lang"); lang == "x-default" {
+						return strings.TrimSpace(li.text), true
+					}
+				}
+			}
+			if len(values) > 0 {
+				return values[0], true
+			}
+			return "", true
+		}
+
+		if value, found := node.attr(NamespaceRDF, "resource"); found {
+			return value, true
+		}
+		return strings.TrimSpace(node.text), true
+	}
+
+	return "", false
+}
+
+func arrayValues(node *xmpNode) ([]string, XMPArrayType) {
+	if len(node.children) != 1 || node.children[0].name.Space != NamespaceRDF {
+		return nil, ""
+	}
+
+	typ := XMPArrayType(node.children[0].name.Local)
+	switch typ {
+	case XMPArrayOrdered, XMPArrayUnordered, XMPArrayAlternative:
+	default:
+		return nil, ""
+	}
+
+	values := []string{}
+	for _, li := range node.children[0].children {
+		if li.name.Space == NamespaceRDF && li.name.Local == "li" {
+			values = append(values, strings.TrimSpace(li.text))
+		}
+	}
+	return values, typ
+}
+
+// GetArray returns the values of an array property. A simple property is
+// returned as array with one element.
+func (x *XMP) GetArray(namespace, name string) ([]string, bool) {
+	for _, d := range x.descriptions() {
+		if value, found := d.attr(namespace, name); found {
+			return []string{value}, true
+		}
+
+		node := d.child(namespace, name)
+		if node == nil {
+			continue
+		}
+
+		if values, typ := arrayValues(node); typ != "" {
+			return values, true
+		}
+		return []string{strings.TrimSpace(node.text)}, true
+	}
+
+	return nil, false
+}
+
+// Remove removes the property.
+func (x *XMP) Remove(namespace, name string) {
+	for _, d := range x.descriptions() {
+		attrs := d.attrs[:0]
+		for _, a := range d.attrs {
+			if a.Name.Space != namespace || a.Name.Local != name {
+				attrs = append(attrs, a)
+			}
+		}
+		d.attrs = attrs
+
+		children := d.children[:0]
+		for _, c := range d.children {
+			if c.name.Space != namespace || c.name.Local != name {
+				children = append(children, c)
+			}
+		}
+		d.children = children
+	}
+}
+
+func (x *XMP) setNode(node *xmpNode) {
+	x.Remove(node.name.Space, node.name.Local)
+	descriptions := x.descriptions()
+	var d *xmpNode
+	if len(descriptions) > 0 {
+		d = descriptions[0]
+	} else {
+		d = &xmpNode{
+			name: xml.Name{Space: NamespaceRDF, Local: "Description"},
+			attrs: []xml.Attr{
+				{Name: xml.Name{Space: NamespaceRDF, Local: "about"}, Value: ""},
+			},
+		}
+		rdf := x.rdf()
+		if rdf == nil {
+			// The zero value has no x:xmpmeta/rdf:RDF skeleton yet.
+			if x.root == nil {
+				x.root = &xmpNode{
+					name: xml.Name{Space: namespaceXMPMeta, Local: "xmpmeta"},
+				}
+			}
+			rdf = &xmpNode{
+				name: xml.Name{Space: NamespaceRDF, Local: "RDF"},
+			}
+			x.root.children = append(x.root.children, rdf)
+		}
+		rdf.children = append(rdf.children, d)
+	}
+	d.children = append(d.children, node)
+}
+
+// Set sets a simple property.
+func (x *XMP) Set(namespace, name, value string) {
+	x.setNode(&xmpNode{
+		name: xml.Name{Space: namespace, Local: name},
+		text: value,
+	})
+}
+
+// SetArray sets an array property. For XMPArrayAlternative, the first value
+// is used as default value.
+func (x *XMP) SetArray(namespace, name string, typ XMPArrayType, values []string) {
+	container := &xmpNode{
+		name: xml.Name{Space: NamespaceRDF, Local: string(typ)},
+	}
+	for idx, value := range values {
+		li := &xmpNode{
+			name: xml.Name{Space: NamespaceRDF, Local: "li"},
+			text: value,
+		}
+		if typ == XMPArrayAlternative && idx == 0 {
+			li.attrs = []xml.Attr{
+				{Name: xml.Name{Space: namespaceXML, Local: "lang"}, Value: "x-default"},
+			}
+		}
+		container.children = append(container.children, li)
+	}
+	x.setNode(&xmpNode{
+		name:     xml.Name{Space: namespace, Local: name},
+		children: []*xmpNode{container},
+	})
+}
+
+// Title returns the Dublin Core title (dc:title).
+func (x *XMP) Title() string {
+	value, _ := x.Get(NamespaceDC, "title")
+	return value
+}
+
+// SetTitle sets the Dublin Core title (dc:title).
+func (x *XMP) SetTitle(title string) {
+	x.SetArray(NamespaceDC, "title", XMPArrayAlternative, []string{title})
+}
+
+// Creators returns the Dublin Core creators (dc:creator).
+func (x *XMP) Creators() []string {
+	values, _ := x.GetArray(NamespaceDC, "creator")
+	return values
+}
+
+// SetCreators sets the Dublin Core creators (dc:creator).
+func (x *XMP) SetCreators(creators []string) {
+	x.SetArray(NamespaceDC, "creator", XMPArrayOrdered, creators)
+}
+
+// Keywords returns the Dublin Core subject (dc:subject).
+func (x *XMP) Keywords() []string {
+	values, _ := x.GetArray(NamespaceDC, "subject")
+	return values
+}
+
+// SetKeywords sets the Dublin Core subject (dc:subject).
+func (x *XMP) SetKeywords(keywords []string) {
+	x.SetArray(NamespaceDC, "subject", XMPArrayUnordered, keywords)
+}
+
+// Rating returns the rating (xmp:Rating), -1 for rejected, 0 if not rated
+// and 1 to 5 otherwise.
+func (x *XMP) Rating() int {
+	value, _ := x.Get(NamespaceXMP, "Rating")
+	rating, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+
+	return int(rating)
+}
+
+// SetRating sets the rating (xmp:Rating).
+func (x *XMP) SetRating(rating int) {
+	x.Set(NamespaceXMP, "Rating", strconv.Itoa(rating))
+}
+
+type xmpWriter struct {
+	buf      bytes.Buffer
+	prefixes map[string]string
+}
+
+func (w *xmpWriter) name(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+
+	return w.prefixes[n.Space] + ":" + n.Local
+}
+
+func (w *xmpWriter) write(node *xmpNode, indent string, declarations []string) {
+	w.buf.WriteString(indent + "<" + w.name(node.name))
+	for _, ns := range declarations {
+		w.buf.WriteString(" xmlns:" + w.prefixes[ns] + "=\"")
+		xml.EscapeText(&w.buf, []byte(ns)) // nolint
+		w.buf.WriteString("\"")
+	}
+	for _, a := range node.attrs {
+		w.buf.WriteString(" " + w.name(a.Name) + "=\"")
+		xml.EscapeText(&w.buf, []byte(a.Value)) // nolint
+		w.buf.WriteString("\"")
+	}
+
+	switch {
+	case len(node.children) > 0:
+		w.buf.WriteString(">\n")
+		for _, c := range node.children {
+			w.write(c, indent+" ", nil)
+		}
+		w.buf.WriteString(indent + "</" + w.name(node.name) + ">\n")
+	case node.text != "":
+		w.buf.WriteString(">")
+		xml.EscapeText(&w.buf, []byte(node.text)) // nolint
+		w.buf.WriteString("</" + w.name(node.name) + ">\n")
+	default:
+		w.buf.WriteString("/>\n")
+	}
+}
+
+func collectNamespaces(node *xmpNode, namespaces map[string]bool) {
+	namespaces[node.name.Space] = true
+	for _, a := range node.attrs {
+		namespaces[a.Name.Space] = true
+	}
+	for _, c := range node.children {
+		collectNamespaces(c, namespaces)
+	}
+}
+
+// Bytes returns the serialized XMP packet.
+func (x *XMP) Bytes() []byte {
+	if x.root == nil {
+		return NewXMP().Bytes()
+	}
+
+	namespaces := make(map[string]bool)
+	collectNamespaces(x.root, namespaces)
+	delete(namespaces, "")
+	delete(namespaces, namespaceXML)
+
+	w := &xmpWriter{
+		prefixes: map[string]string{
+			namespaceXML: "xml",
+		},
+	}
+	used := map[string]bool{
+		"xml": true,
+	}
+	var declarations []string
+	for ns := range namespaces {
+		declarations = append(declarations, ns)
+	}
+	sort.Strings(declarations)
+	for _, ns := range declarations {
+		prefix := x.prefixes[ns]
+		if prefix == "" || used[prefix] {
+			prefix = defaultXMPPrefixes[ns]
+		}
+		for idx := 1; prefix == "" || used[prefix]; idx++ {
+			prefix = fmt.Sprintf("ns%d", idx)
+		}
+		w.prefixes[ns] = prefix
+		used[prefix] = true
+	}
+
+	w.buf.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	w.write(x.root, "", declarations)
+	w.buf.WriteString("<?xpacket end=\"w\"?>")
+	return w.buf.Bytes()
+}
+
+// GetXMP returns the parsed XMP metadata of the image or nil if the image has
+// no XMP metadata.
+func (h *ImageHandle) GetXMP() (*XMP, error) {
+	if h.handle == nil {
+		return nil, ErrClosed
+	}
+
+	for _, id := range h.GetMetadataBlockIDs("mime") {
+		if h.GetMetadataContentType(id) != XMPContentType {
+			continue
+		}
+
+		data, err := h.GetMetadata(id)
+		if err != nil {
+			return nil, err
+		}
+
+		return ParseXMP(data)
+	}
+
+	return nil, nil
+}
+
+// AddXMP adds the XMP metadata to the image.
+func (c *Context) AddXMP(handle *ImageHandle, x *XMP) error {
+	return c.AddXmpMetadata(handle, x.Bytes())
+}
@@ -0,0 +1,164 @@
+/*
+ * Go interface to libheif
+ *
+ * Copyright (c) 2018-2024 struktur AG, Joachim Bauch <bauch@struktur.de>
+ *
+ * libheif is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * libheif is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ *
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with libheif.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package libheif
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const namespacePhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+
+func checkExampleXMP(t *testing.T, x *XMP) {
+	t.Helper()
+	assert := assert.New(t)
+
+	assert.Equal("Example & Test", x.Title())
+	assert.Equal([]string{"Jane Doe", "John Doe"}, x.Creators())
+	assert.Equal([]string{"landscape", "sunset"}, x.Keywords())
+	assert.Equal(3, x.Rating())
+	if value, found := x.Get(namespacePhotoshop, "City"); assert.True(found) {
+		assert.Equal("Berlin", value)
+	}
+	if value, found := x.Get(NamespaceXMP, "CreatorTool"); assert.True(found) {
+		assert.Equal("Example Editor 1.0", value)
+	}
+	_, found := x.Get(NamespaceXMP, "Label")
+	assert.False(found)
+}
+
+func TestXMPRoundtrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.xmp")
+	require.NoError(err)
+
+	x, err := ParseXMP(data)
+	require.NoError(err)
+	checkExampleXMP(t, x)
+
+	// Serializing without modifications keeps all properties.
+	x2, err := ParseXMP(x.Bytes())
+	require.NoError(err)
+	checkExampleXMP(t, x2)
+	assert.Contains(string(x.Bytes()), "photoshop:City")
+
+	x2.SetTitle("New <title>")
+	x2.SetCreators([]string{"Max Mustermann"})
+	x2.SetKeywords([]string{"city", "night", "rain"})
+	x2.SetRating(5)
+	x2.Remove(namespacePhotoshop, "City")
+	x2.Set("http://example.com/ns/", "Custom", "value")
+
+	x3, err := ParseXMP(x2.Bytes())
+	require.NoError(err)
+	assert.Equal("New <title>", x3.Title())
+	assert.Equal([]string{"Max Mustermann"}, x3.Creators())
+	assert.Equal([]string{"city", "night", "rain"}, x3.Keywords())
+	assert.Equal(5, x3.Rating())
+	_, found := x3.Get(namespacePhotoshop, "City")
+	assert.False(found)
+	if value, found := x3.Get("http://example.com/ns/", "Custom"); assert.True(found) {
+		assert.Equal("value", value)
+	}
+	if value, found := x3.Get(NamespaceXMP, "CreatorTool"); assert.True(found) {
+		assert.Equal("Example Editor 1.0", value)
+	}
+}
+
+func TestNewXMP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	x := NewXMP()
+	assert.Equal("", x.Title())
+	x.SetTitle("Title")
+	x.SetRating(-1)
+
+	x2, err := ParseXMP(x.Bytes())
+	require.NoError(err)
+	assert.Equal("Title", x2.Title())
+	assert.Equal(-1, x2.Rating())
+
+	_, err = ParseXMP([]byte("<foo/>"))
+	assert.Error(err)
+	_, err = ParseXMP([]byte("<x:xmpmeta"))
+	assert.Error(err)
+}
+
+func TestEncodeXMP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := os.ReadFile("testdata/example.xmp")
+	require.NoError(err)
+	x, err := ParseXMP(data)
+	require.NoError(err)
+
+	img := loadImage(t, "testdata/example-1.jpg")
+	ctx, _, err := EncodeFromImageWithOptions(img, CompressionHEVC,
+		SetEncoderQuality(50),
+		WithXMP(x),
+	)
+	require.NoError(err)
+
+	var out bytes.Buffer
+	require.NoError(ctx.Write(&out))
+
+	ctx2, err := NewContext()
+	require.NoError(err)
+	require.NoError(ctx2.ReadFromMemory(out.Bytes()))
+	handle, err := ctx2.GetPrimaryImageHandle()
+	require.NoError(err)
+
+	x2, err := handle.GetXMP()
+	require.NoError(err)
+	if assert.NotNil(x2) {
+		checkExampleXMP(t, x2)
+	}
+}
+
+func TestZeroValueXMP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	x := &XMP{}
+	_, found := x.Get(NamespaceDC, "format")
+	assert.False(found)
+	x.Remove(NamespaceDC, "format")
+
+	x.Set(NamespaceDC, "format", "image/heic")
+	value, found := x.Get(NamespaceDC, "format")
+	assert.True(found)
+	assert.Equal("image/heic", value)
+
+	x2, err := ParseXMP(x.Bytes())
+	require.NoError(err)
+	value, _ = x2.Get(NamespaceDC, "format")
+	assert.Equal("image/heic", value)
+
+	_, err = ParseXMP((&XMP{}).Bytes())
+	assert.NoError(err)
+}